@@ -42,6 +42,9 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"syscall"
 	"time"
 )
 
@@ -60,7 +63,14 @@ import (
 // Exactly one Status is sent on the channel when the command ends. The channel
 // is not closed. Any Go error is set to Status.Error. Start is idempotent; it
 // always returns the same channel.
-func (c *Cmd) Start() <-chan Status {
+func (c *Cmd) Start() <-chan Status { return c.StartContext(context.Background()) }
+
+// StartContext is like Start but ties the lifetime of the command to ctx. If
+// ctx is done before the command ends, the command is stopped the same way Stop
+// stops it and Status.Cancelled is true. If ctx is already done, the command is
+// not started and Status.Error is ctx.Err(). Like Start, StartContext is
+// idempotent; only the context of the first call is used.
+func (c *Cmd) StartContext(ctx context.Context) <-chan Status {
 	c.Lock()
 	if c.statusChan != nil {
 		c.Unlock()
@@ -70,7 +80,7 @@ func (c *Cmd) Start() <-chan Status {
 	c.statusChan = make(chan Status, 1)
 	started := make(chan bool)
 
-	go c.run(started)
+	go c.run(ctx, started)
 
 	c.Unlock()
 
@@ -79,10 +89,11 @@ func (c *Cmd) Start() <-chan Status {
 	return c.statusChan
 }
 
-// Stop stops the command by sending its process group a SIGTERM signal.
-// Stop is idempotent. An error should only be returned in the rare case that
-// Stop is called immediately after the command ends but before Start can
-// update its internal state.
+// Stop stops the command by sending its process group a SIGTERM signal. If
+// Options.KillGrace is set, the process group is sent a SIGKILL signal when the
+// command is still running after the grace period. Stop is idempotent. An error
+// should only be returned in the rare case that Stop is called immediately after
+// the command ends but before Start can update its internal state.
 func (c *Cmd) Stop() error {
 	c.Lock()
 	defer c.Unlock()
@@ -93,6 +104,44 @@ func (c *Cmd) Stop() error {
 		return nil
 	}
 
+	return c.stopWithGrace()
+}
+
+// StopGracefully stops the command by sending its process group a SIGTERM
+// signal, waiting up to grace for the command to end, then sending its process
+// group a SIGKILL signal if it's still running. Unlike Stop, StopGracefully
+// blocks until the command ends or the grace period has elapsed. Use it for
+// commands that trap or ignore SIGTERM. Status.Signal reports which signal
+// actually ended the command.
+func (c *Cmd) StopGracefully(grace time.Duration) error {
+	c.Lock()
+
+	if c.statusChan == nil || !c.started || c.done {
+		c.Unlock()
+		return nil
+	}
+
+	err := c.stop()
+	c.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return c.killAfter(grace)
+}
+
+// stop flags the command as stopped, closes STDIN and sends its process group
+// a SIGTERM signal. The caller must hold the lock.
+func (c *Cmd) stop() error {
+	c.markStopped()
+
+	return SyscallKill(-c.groupID())
+}
+
+// markStopped flags the command as stopped and closes STDIN. The caller must
+// hold the lock.
+func (c *Cmd) markStopped() {
 	// Flag that command was stopped, it didn't complete. This results in
 	// status.Complete = false
 	c.stopped = true
@@ -101,8 +150,100 @@ func (c *Cmd) Stop() error {
 		SafeClose(c.Stdin)
 		c.Stdin = nil
 	}
+}
+
+// groupID returns the process group ID of the running command: its PID, unless
+// it joined the process group of a Pipeline. The caller must hold the lock.
+func (c *Cmd) groupID() int {
+	if c.pgid > 0 {
+		return c.pgid
+	}
+
+	return c.status.PID
+}
+
+// stopWithGrace is stop followed by the background SIGKILL escalation when
+// Options.KillGrace is set. The caller must hold the lock.
+func (c *Cmd) stopWithGrace() error {
+	if err := c.stop(); err != nil {
+		return err
+	}
+
+	if c.killGrace > 0 {
+		go func() { _ = c.killAfter(c.killGrace) }()
+	}
+
+	return nil
+}
+
+// cancel stops the command because the context given to StartContext is done.
+func (c *Cmd) cancel(err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done {
+		return
+	}
 
-	return SyscallKill(-c.status.PID)
+	c.status.Cancelled = true
+	c.cancelErr = err
+	_ = c.stopWithGrace()
+}
+
+// killAfter waits up to grace for the command to end, else it sends the
+// process group a SIGKILL signal.
+func (c *Cmd) killAfter(grace time.Duration) error {
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-c.doneChan:
+		return nil
+	case <-timer.C:
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done {
+		return nil
+	}
+
+	return SyscallSignal(-c.groupID(), syscall.SIGKILL)
+}
+
+// Signal sends sig to the running command. If group is true, sig is sent to the
+// command's process group (see SetGroupID), that is the command and all its
+// children; else, sig is only sent to the command process (the group leader).
+// Signal returns ErrNotStarted if the command has not been started and ErrDone
+// if it has already finished; no signal is sent in either case.
+//
+// Unlike Stop, Signal does not flag the command as stopped and does not close
+// STDIN, so it can be used to ask a daemon to reload its config (SIGHUP) or
+// dump its stack traces (SIGQUIT) without ending it.
+func (c *Cmd) Signal(sig os.Signal, group bool) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return ErrUnsupportedSignal{Signal: sig}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.statusChan == nil || !c.started {
+		return ErrNotStarted
+	}
+
+	if c.done {
+		return ErrDone
+	}
+
+	pid := c.status.PID
+	if group {
+		pid = -c.groupID()
+	}
+
+	return SyscallSignal(pid, s)
 }
 
 // Status returns the Status of the command at any time. It is safe to call
@@ -116,9 +257,9 @@ func (c *Cmd) Stop() error {
 //   "1 2"
 //   "1 2 3"
 //
-// The caller is responsible for tailing the buffered output if needed. Else,
-// consider using streaming output. When the command finishes, buffered output
-// is complete and final.
+// To only get the lines written since the last call, use StdoutSince and
+// StderrSince instead. Else, consider using streaming output. When the command
+// finishes, buffered output is complete and final.
 //
 // Status.Runtime is updated while the command is running and final when it
 // finishes.
@@ -135,24 +276,183 @@ func (c *Cmd) Status() Status {
 		// No longer running
 		if !c.final {
 			if c.buffered {
-				c.status.Stdout = c.stdout.Lines()
-				c.status.Stderr = c.stderr.Lines()
-				c.stdout = nil // release buffers
-				c.stderr = nil
+				c.readBuffers()
+				c.releaseBuffers()
 			}
 
+			c.readStreams()
+			c.releaseRaw()
 			c.final = true
 		}
 	} else {
 		// Still running
 		c.status.Runtime = time.Since(c.startTime).Seconds()
 		if c.buffered {
-			c.status.Stdout = c.stdout.Lines()
-			c.status.Stderr = c.stderr.Lines()
+			c.readBuffers()
 		}
+
+		c.readStreams()
+	}
+
+	return c.status.copyOutput()
+}
+
+// copyOutput returns the status with a copy of its buffered output, which
+// otherwise shares the lines of the buffers, so callers can modify the lines
+// without changing the output of later calls.
+func (s Status) copyOutput() Status {
+	s.Stdout = copyLines(s.Stdout)
+	s.Stderr = copyLines(s.Stderr)
+	s.Combined = copyLines(s.Combined)
+
+	if s.Lines != nil {
+		s.Lines = append(make([]Line, 0, len(s.Lines)), s.Lines...)
+	}
+
+	return s
+}
+
+func copyLines(lines []string) []string {
+	if lines == nil {
+		return nil
 	}
 
-	return c.status
+	return append(make([]string, 0, len(lines)), lines...)
+}
+
+// StdoutSince returns the lines of buffered STDOUT written after the first
+// offset lines, and the offset to pass to the next call to get only newer lines.
+// Start with offset zero. Unlike Status, which copies all buffered output, it
+// is efficient to call frequently while the command is running, like once per
+// second to refresh a UI. It is also safe to call after the command finishes.
+// If output is not buffered or the command has not been started, it returns no
+// lines and offset. See OutputBuffer.LinesSince for more info.
+func (c *Cmd) StdoutSince(offset int) (lines []string, next int) {
+	return c.linesSince(stdoutOutput, offset)
+}
+
+// StderrSince is like StdoutSince but returns lines of buffered STDERR.
+func (c *Cmd) StderrSince(offset int) (lines []string, next int) {
+	return c.linesSince(stderrOutput, offset)
+}
+
+// CombinedSince is like StdoutSince but returns lines of buffered STDOUT and
+// STDERR with Options.CombinedOutput, which are not in StdoutSince and
+// StderrSince.
+func (c *Cmd) CombinedSince(offset int) (lines []string, next int) {
+	return c.linesSince(combinedOutput, offset)
+}
+
+// bufferedOutput selects the buffered output read by linesSince.
+type bufferedOutput int
+
+const (
+	stdoutOutput bufferedOutput = iota
+	stderrOutput
+	combinedOutput
+)
+
+func (c *Cmd) linesSince(which bufferedOutput, offset int) ([]string, int) {
+	c.Lock()
+
+	if c.statusChan == nil || !c.started || !c.buffered {
+		c.Unlock()
+		return nil, offset
+	}
+
+	if which == combinedOutput && !c.combinedOutput {
+		c.Unlock()
+		return nil, offset
+	}
+
+	if c.final {
+		s := c.finalLines(which)
+		c.Unlock()
+
+		return s.linesSince(offset)
+	}
+
+	out := c.buffer(which)
+	c.Unlock()
+
+	return out.LinesSince(offset)
+}
+
+// buffer returns the buffer of the output. The caller must hold the lock.
+func (c *Cmd) buffer(which bufferedOutput) *OutputBuffer {
+	switch which {
+	case stderrOutput:
+		return c.stderr
+	case combinedOutput:
+		return c.combined
+	default:
+		return c.stdout
+	}
+}
+
+// finalLines returns the final lines of the output once the buffers are
+// released. The caller must hold the lock.
+func (c *Cmd) finalLines(which bufferedOutput) outputSnapshot {
+	switch which {
+	case stderrOutput:
+		return c.stderrLines
+	case combinedOutput:
+		return c.combinedLines
+	default:
+		return c.stdoutLines
+	}
+}
+
+// readBuffers sets the buffered output of the status. The caller must hold the
+// lock.
+func (c *Cmd) readBuffers() {
+	c.status.Stdout = c.stdout.Lines()
+	c.status.Stderr = c.stderr.Lines()
+	c.status.StdoutTruncated = c.stdout.Truncated()
+	c.status.StderrTruncated = c.stderr.Truncated()
+
+	if c.combined != nil {
+		c.status.Combined = c.combined.Lines()
+		c.status.CombinedTruncated = c.combined.Truncated()
+	}
+
+	if c.streamLines {
+		c.status.Lines = c.hub.lines()
+	}
+}
+
+// releaseBuffers releases the buffers once the status is final. Only their
+// final lines are kept for StdoutSince, StderrSince and CombinedSince, which
+// share the lines of the status, so a finished Cmd does not keep its output
+// twice. The caller must hold the lock.
+func (c *Cmd) releaseBuffers() {
+	c.stdoutLines = c.stdout.snapshot()
+	c.stderrLines = c.stderr.snapshot()
+
+	if c.combined != nil {
+		c.combinedLines = c.combined.snapshot()
+	}
+	c.stdout = nil
+	c.stderr = nil
+	c.combined = nil
+}
+
+// readStreams sets the streaming output counters of the status. The caller must
+// hold the lock.
+func (c *Cmd) readStreams() {
+	if c.stdoutStream != nil {
+		c.status.StdoutDropped = c.stdoutStream.Dropped()
+		c.status.StderrDropped = c.stderrStream.Dropped()
+	}
+}
+
+// releaseRaw moves the exact STDOUT bytes to the status once it is final, like
+// releaseBuffers, so they are not kept twice. The caller must hold the lock.
+func (c *Cmd) releaseRaw() {
+	if c.rawBuf != nil {
+		c.status.StdoutBytes = c.rawBuf.bytes()
+		c.rawBuf = nil
+	}
 }
 
 // Done returns a channel that's closed when the command stops running.
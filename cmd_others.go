@@ -11,7 +11,11 @@ func SyscallKill(pid int) error {
 	// Signal the process group (-pid), not just the process, so that the process
 	// and all its children are signaled. Else, child procs can keep running and
 	// keep the stdout/stderr fd open and cause cmd.Wait to hang.
-	return syscall.Kill(pid, syscall.SIGTERM)
+	return SyscallSignal(pid, syscall.SIGTERM)
+}
+
+func SyscallSignal(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
 }
 
 func SetGroupID(cmd *exec.Cmd) {
@@ -20,3 +24,9 @@ func SetGroupID(cmd *exec.Cmd) {
 	// without killing this process (i.e. this code here).
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
+
+func joinGroup(cmd *exec.Cmd, pgid int) {
+	// Join the process group of the first command of a Pipeline, so Stop signals
+	// all the commands of the pipeline and their children.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pgid}
+}
@@ -1,10 +1,13 @@
 package cmd_test
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"syscall"
 	"testing"
 	"time"
@@ -26,8 +29,11 @@ func TestTimeout(t *testing.T) {
 		PID:      gotStatus.PID, // nondeterministic
 		Complete: false,
 		Exit:     -1,
-		Error:    errors.New("signal: killed"),
+		Signal:   syscall.SIGKILL,
+		Error:    &cmd.SignalError{Signal: syscall.SIGKILL, Err: cmd.ErrTimeout},
+		Reason:   cmd.ReasonTimedOut,
 		Runtime:  gotStatus.Runtime, // nondeterministic
+		Rusage:   gotStatus.Rusage,  // nondeterministic
 		Stdout:   gotStatus.Stdout,
 		Stderr:   []string{},
 		StartTs:  gotStatus.StartTs,
@@ -49,7 +55,9 @@ func TestCmdOK(t *testing.T) {
 		Complete: true,
 		Exit:     0,
 		Error:    nil,
+		Reason:   cmd.ReasonExited,
 		Runtime:  gotStatus.Runtime, // nondeterministic
+		Rusage:   gotStatus.Rusage,  // nondeterministic
 		Stdout:   []string{"foo"},
 		Stderr:   []string{},
 	}
@@ -87,7 +95,9 @@ func TestCmdNonzeroExit(t *testing.T) {
 		Complete: true,
 		Exit:     1,
 		Error:    nil,
+		Reason:   cmd.ReasonExited,
 		Runtime:  gotStatus.Runtime, // nondeterministic
+		Rusage:   gotStatus.Rusage,  // nondeterministic
 		Stdout:   []string{},
 		Stderr:   []string{},
 	}
@@ -150,11 +160,14 @@ func TestCmdStop(t *testing.T) { // nolint funlen
 
 	expectStatus := cmd.Status{
 		Cmd:      "./test/count-and-sleep",
-		PID:      gotStatus.PID,                    // nondeterministic
-		Complete: false,                            // signaled by Stop
-		Exit:     -1,                               // signaled by Stop
-		Error:    errors.New("signal: terminated"), // signaled by Stop
-		Runtime:  gotStatus.Runtime,                // nondeterministic
+		PID:      gotStatus.PID,                                                  // nondeterministic
+		Complete: false,                                                          // signaled by Stop
+		Exit:     -1,                                                             // signaled by Stop
+		Signal:   syscall.SIGTERM,                                                // signaled by Stop
+		Error:    &cmd.SignalError{Signal: syscall.SIGTERM, Err: cmd.ErrStopped}, // signaled by Stop
+		Reason:   cmd.ReasonStopped,                                              // signaled by Stop
+		Runtime:  gotStatus.Runtime,                                              // nondeterministic
+		Rusage:   gotStatus.Rusage,                                               // nondeterministic
 		Stdout:   []string{"1"},
 		Stderr:   []string{},
 	}
@@ -171,6 +184,10 @@ func TestCmdStop(t *testing.T) { // nolint funlen
 		t.Errorf("got runtime %f, expected non-zero", gotStatus.Runtime)
 	}
 
+	if !errors.Is(gotStatus.Error, cmd.ErrStopped) {
+		t.Errorf("got err %v, expected errors.Is cmd.ErrStopped", gotStatus.Error)
+	}
+
 	// Stop should be idempotent
 	err = p.Stop()
 	if err != nil {
@@ -184,6 +201,306 @@ func TestCmdStop(t *testing.T) { // nolint funlen
 	}
 }
 
+func TestCmdStopGracefully(t *testing.T) {
+	// test/ignore-sigterm ignores SIGTERM, so only SIGKILL can end it.
+	p := cmd.NewCmd("./test/ignore-sigterm")
+	statusChan := p.Start()
+
+	time.Sleep(500 * time.Millisecond)
+
+	if err := p.StopGracefully(500 * time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if gotStatus.Signal != syscall.SIGKILL {
+		t.Errorf("got signal %v, expected %v", gotStatus.Signal, syscall.SIGKILL)
+	}
+
+	if gotStatus.Complete {
+		t.Error("got Complete = true, expected false")
+	}
+
+	if diffs := deep.Equal(gotStatus.Stdout, []string{"1"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// StopGracefully is idempotent, too
+	if err := p.StopGracefully(500 * time.Millisecond); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCmdStopGracefullyTerm(t *testing.T) {
+	// count-and-sleep does not trap SIGTERM, so SIGKILL is never needed.
+	p := cmd.NewCmd("./test/count-and-sleep", "3", "5")
+	statusChan := p.Start()
+
+	time.Sleep(500 * time.Millisecond)
+
+	if err := p.StopGracefully(5 * time.Second); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if gotStatus.Signal != syscall.SIGTERM {
+		t.Errorf("got signal %v, expected %v", gotStatus.Signal, syscall.SIGTERM)
+	}
+}
+
+func TestCmdKillGrace(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, KillGrace: 500 * time.Millisecond}, "./test/ignore-sigterm")
+	statusChan := p.Start()
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Stop does not block, SIGKILL is sent in the background after KillGrace
+	if err := p.Stop(); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if gotStatus.Signal != syscall.SIGKILL {
+		t.Errorf("got signal %v, expected %v", gotStatus.Signal, syscall.SIGKILL)
+	}
+}
+
+func TestCmdSignal(t *testing.T) {
+	p := cmd.NewCmd("./test/trap-signals")
+
+	if err := p.Signal(syscall.SIGHUP, false); err != cmd.ErrNotStarted {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrNotStarted)
+	}
+
+	statusChan := p.Start()
+
+	time.Sleep(300 * time.Millisecond)
+
+	if err := p.Signal(syscall.SIGHUP, false); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if err := p.Signal(syscall.SIGUSR1, true); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if diffs := deep.Equal(p.Status().Stdout, []string{"ready", "hup", "usr1"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if err := p.Signal(syscall.SIGINT, true); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if gotStatus.Signal != syscall.SIGINT {
+		t.Errorf("got signal %v, expected %v", gotStatus.Signal, syscall.SIGINT)
+	}
+
+	if gotStatus.Reason != cmd.ReasonSignaled {
+		t.Errorf("got reason %v, expected %v", gotStatus.Reason, cmd.ReasonSignaled)
+	}
+
+	if err := p.Signal(syscall.SIGHUP, true); err != cmd.ErrDone {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrDone)
+	}
+}
+
+func TestCmdStartContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := cmd.NewCmd("./test/count-and-sleep", "3", "5")
+	statusChan := p.StartContext(ctx)
+
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if !gotStatus.Cancelled {
+		t.Error("got Cancelled = false, expected true")
+	}
+
+	if gotStatus.Reason != cmd.ReasonContextCancelled {
+		t.Errorf("got reason %v, expected %v", gotStatus.Reason, cmd.ReasonContextCancelled)
+	}
+
+	if !errors.Is(gotStatus.Error, context.Canceled) {
+		t.Errorf("got err %v, expected errors.Is context.Canceled", gotStatus.Error)
+	}
+
+	if gotStatus.Complete {
+		t.Error("got Complete = true, expected false")
+	}
+
+	if gotStatus.Signal != syscall.SIGTERM {
+		t.Errorf("got signal %v, expected %v", gotStatus.Signal, syscall.SIGTERM)
+	}
+
+	if diffs := deep.Equal(gotStatus.Stdout, []string{"1"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestCmdStartContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, gotStatus := cmd.RunContext(ctx, "echo", "foo")
+
+	if gotStatus.Error != context.Canceled {
+		t.Errorf("got err %v, expected %v", gotStatus.Error, context.Canceled)
+	}
+
+	if !gotStatus.Cancelled {
+		t.Error("got Cancelled = false, expected true")
+	}
+
+	if gotStatus.PID != 0 {
+		t.Errorf("got PID %d, expected 0", gotStatus.PID)
+	}
+
+	// The streaming channels are closed though the output was never set up
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, CloseStreams: true}, "echo", "foo")
+	<-p.StartContext(ctx)
+
+	for range p.Stdout {
+		t.Error("got STDOUT line, expected none")
+	}
+
+	for range p.Stderr {
+		t.Error("got STDERR line, expected none")
+	}
+}
+
+func TestCmdRusage(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", "for i in $(seq 100000); do :; done; sleep 1")
+
+	if _, err := p.SampleRusage(); err != cmd.ErrNotStarted {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrNotStarted)
+	}
+
+	statusChan := p.Start()
+
+	time.Sleep(500 * time.Millisecond)
+
+	sample, err := p.SampleRusage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sample.UserTime+sample.SystemTime <= 0 {
+		t.Errorf("got CPU time %s, expected > 0", sample.UserTime+sample.SystemTime)
+	}
+
+	if sample.MaxRSS <= 0 {
+		t.Errorf("got MaxRSS %d, expected > 0", sample.MaxRSS)
+	}
+
+	gotStatus := <-statusChan
+	if gotStatus.Rusage == nil {
+		t.Fatal("got nil Rusage")
+	}
+
+	if gotStatus.Rusage.UserTime+gotStatus.Rusage.SystemTime < sample.UserTime+sample.SystemTime {
+		t.Errorf("got final CPU time %s, expected >= sampled %s",
+			gotStatus.Rusage.UserTime+gotStatus.Rusage.SystemTime, sample.UserTime+sample.SystemTime)
+	}
+
+	if gotStatus.Rusage.MaxRSS <= 0 {
+		t.Errorf("got MaxRSS %d, expected > 0", gotStatus.Rusage.MaxRSS)
+	}
+
+	if gotStatus.Rusage.VoluntaryCtxSwitches <= 0 {
+		t.Errorf("got VoluntaryCtxSwitches %d, expected > 0", gotStatus.Rusage.VoluntaryCtxSwitches)
+	}
+
+	final, err := p.SampleRusage()
+	if err != nil || final != gotStatus.Rusage {
+		t.Errorf("got %v, %v, expected final Status.Rusage", final, err)
+	}
+}
+
+func TestCmdProcesses(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", "sleep 5 & sleep 5 & wait")
+
+	if _, err := p.Processes(); err != cmd.ErrNotStarted {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrNotStarted)
+	}
+
+	statusChan := p.Start()
+
+	time.Sleep(300 * time.Millisecond)
+
+	procs, err := p.Processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(procs) != 3 {
+		t.Fatalf("got %d processes, expected 3: %+v", len(procs), procs)
+	}
+
+	pid := p.Status().PID
+
+	if procs[0].PID != pid || procs[0].Depth != 0 || procs[0].Cmdline[0] != "bash" {
+		t.Errorf("got root %+v, expected bash with PID %d", procs[0], pid)
+	}
+
+	for _, proc := range procs[1:] {
+		if proc.PPID != pid || proc.PGID != pid || proc.Depth != 1 {
+			t.Errorf("got %+v, expected child of %d at depth 1", proc, pid)
+		}
+
+		if diffs := deep.Equal(proc.Cmdline, []string{"sleep", "5"}); diffs != nil {
+			t.Error(diffs)
+		}
+
+		if proc.RSS <= 0 {
+			t.Errorf("got RSS %d, expected > 0", proc.RSS)
+		}
+	}
+
+	_ = p.Stop()
+	<-statusChan
+
+	if _, err := p.Processes(); err != cmd.ErrDone {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrDone)
+	}
+}
+
 func TestCmdNotStarted(t *testing.T) {
 	// Call everything _but_ Start.
 	p := cmd.NewCmd("echo", "foo")
@@ -195,6 +512,7 @@ func TestCmdNotStarted(t *testing.T) {
 		Complete: false,
 		Exit:     -1,
 		Error:    nil,
+		Reason:   cmd.ReasonNone,
 		Runtime:  0,
 		Stdout:   nil,
 		Stderr:   nil,
@@ -298,16 +616,69 @@ func TestCmdNotFound(t *testing.T) {
 		PID:      0,
 		Complete: false,
 		Exit:     -1,
-		Error:    &exec.Error{Name: "cmd-does-not-exist", Err: errors.New(`executable file not found in $PATH`)},
-		Runtime:  0,
-		Stdout:   nil,
-		Stderr:   nil,
+		Error: &cmd.StartError{
+			Name: "cmd-does-not-exist",
+			Err:  &exec.Error{Name: "cmd-does-not-exist", Err: errors.New(`executable file not found in $PATH`)},
+		},
+		Reason:  cmd.ReasonStartFailed,
+		Runtime: 0,
+		Stdout:  nil,
+		Stderr:  nil,
 	}
 
 	if diffs := deep.Equal(gotStatus, expectStatus); diffs != nil {
 		t.Logf("%+v", gotStatus)
 		t.Error(diffs)
 	}
+
+	if !errors.Is(gotStatus.Error, exec.ErrNotFound) {
+		t.Errorf("got err %v, expected errors.Is exec.ErrNotFound", gotStatus.Error)
+	}
+
+	var startErr *cmd.StartError
+	if !errors.As(gotStatus.Err(), &startErr) || startErr.Name != "cmd-does-not-exist" {
+		t.Errorf("got err %v, expected *cmd.StartError", gotStatus.Err())
+	}
+}
+
+func TestCmdErr(t *testing.T) {
+	_, gotStatus := cmd.Run("bash", "-c", "echo oops >&2; exit 3")
+
+	if gotStatus.Error != nil {
+		t.Errorf("got Error %v, expected nil", gotStatus.Error)
+	}
+
+	var exitErr *cmd.ExitError
+	if !errors.As(gotStatus.Err(), &exitErr) {
+		t.Fatalf("got err %v, expected *cmd.ExitError", gotStatus.Err())
+	}
+
+	expectErr := &cmd.ExitError{Code: 3, StderrTail: []string{"oops"}}
+	if diffs := deep.Equal(exitErr, expectErr); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if _, okStatus := cmd.Run("true"); okStatus.Err() != nil {
+		t.Errorf("got err %v, expected nil", okStatus.Err())
+	}
+
+	// With Options.ExitError, Status.Error is the *ExitError
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, ExitError: true}, "bash", "-c", "echo oops >&2; exit 3")
+	gotStatus = <-p.Start()
+
+	exitErr = nil
+	if !errors.As(gotStatus.Error, &exitErr) {
+		t.Fatalf("got Error %v, expected *cmd.ExitError", gotStatus.Error)
+	}
+
+	if diffs := deep.Equal(exitErr, expectErr); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if gotStatus.Exit != 3 || !gotStatus.Complete || gotStatus.Reason != cmd.ReasonExited {
+		t.Errorf("got exit %d, complete %v, reason %v, expected 3, true, %v",
+			gotStatus.Exit, gotStatus.Complete, gotStatus.Reason, cmd.ReasonExited)
+	}
 }
 
 func TestCmdLost(t *testing.T) {
@@ -354,8 +725,11 @@ func TestCmdLost(t *testing.T) {
 		PID:      s.PID,
 		Complete: false,
 		Exit:     -1,
-		Error:    errors.New("signal: killed"),
+		Signal:   syscall.SIGKILL,
+		Error:    &cmd.SignalError{Signal: syscall.SIGKILL},
+		Reason:   cmd.ReasonSignaled,
 		Runtime:  0,
+		Rusage:   gotStatus.Rusage, // nondeterministic
 		Stdout:   []string{"1"},
 		Stderr:   []string{},
 	}
@@ -675,7 +1049,9 @@ func TestCmdEnvOK(t *testing.T) {
 		Complete: true,
 		Exit:     0,
 		Error:    nil,
+		Reason:   cmd.ReasonExited,
 		Runtime:  gotStatus.Runtime, // nondeterministic
+		Rusage:   gotStatus.Rusage,  // nondeterministic
 		Stdout:   []string{"FOO=foo"},
 		Stderr:   []string{},
 	}
@@ -722,3 +1098,257 @@ func TestCmdNoOutput(t *testing.T) {
 		t.Errorf("got stderr, expected no output: %v", s.Stderr)
 	}
 }
+
+func TestCmdOutputLimits(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{
+		Buffered:     true,
+		OutputLimits: cmd.OutputLimits{HeadLines: 1, TailLines: 2},
+	}, "seq", "10")
+	s := <-p.Start()
+
+	expect := []string{"1", "... 7 lines truncated ...", "9", "10"}
+	if diffs := deep.Equal(s.Stdout, expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if s.StdoutTruncated != 7 {
+		t.Errorf("got %d truncated lines, expected 7", s.StdoutTruncated)
+	}
+
+	if s.StderrTruncated != 0 {
+		t.Errorf("got %d truncated lines, expected 0", s.StderrTruncated)
+	}
+}
+
+func TestCmdStdoutSince(t *testing.T) {
+	p := cmd.NewCmd("./test/count-and-sleep", "3", "0.1")
+
+	lines, next := p.StdoutSince(0)
+	if len(lines) != 0 || next != 0 {
+		t.Errorf("got %v, %d before start, expected no lines and 0", lines, next)
+	}
+
+	p.Start()
+
+	var got []string
+
+	for len(got) < 3 {
+		lines, next = p.StdoutSince(next)
+		got = append(got, lines...)
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	<-p.Done()
+
+	// No new lines after the command finishes
+	lines, next = p.StdoutSince(next)
+	if len(lines) != 0 || next != 3 {
+		t.Errorf("got %v, %d after done, expected no lines and 3", lines, next)
+	}
+
+	if diffs := deep.Equal(got, []string{"1", "2", "3"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// The final lines are kept once the buffers are released
+	lines, next = p.StdoutSince(1)
+	if diffs := deep.Equal(lines, []string{"2", "3"}); diffs != nil || next != 3 {
+		t.Errorf("got %v, %d after done, expected [2 3] and 3", lines, next)
+	}
+
+	if lines, _ := p.StderrSince(0); len(lines) != 0 {
+		t.Errorf("got stderr %v, expected none", lines)
+	}
+}
+
+func TestCmdStatusCopy(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", "echo b; echo a; sleep 0.3")
+	p.Start()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Modifying the lines of a status, running or final, does not change the
+	// output of later calls
+	for _, wait := range []bool{false, true} {
+		if wait {
+			<-p.Done()
+		}
+
+		s := p.Status()
+		sort.Strings(s.Stdout)
+
+		if diffs := deep.Equal(p.Status().Stdout, []string{"b", "a"}); diffs != nil {
+			t.Errorf("done %v: %v", wait, diffs)
+		}
+
+		lines, _ := p.StdoutSince(0)
+		if diffs := deep.Equal(lines, []string{"b", "a"}); diffs != nil {
+			t.Errorf("done %v: %v", wait, diffs)
+		}
+	}
+}
+
+func TestCmdStreamPolicy(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, StreamPolicy: cmd.StreamDropNewest},
+		"seq", strconv.Itoa(cmd.DefaultStreamChanSize+10))
+
+	// Streaming channels are not read, but the command isn't stalled
+	s := <-p.Start()
+
+	if s.Exit != 0 {
+		t.Errorf("got exit %d, expected 0", s.Exit)
+	}
+
+	if s.StdoutDropped != 10 {
+		t.Errorf("got %d dropped lines, expected 10", s.StdoutDropped)
+	}
+
+	if s.StderrDropped != 0 {
+		t.Errorf("got %d dropped lines, expected 0", s.StderrDropped)
+	}
+
+	if n := len(p.Stdout); n != cmd.DefaultStreamChanSize {
+		t.Errorf("got %d lines, expected %d", n, cmd.DefaultStreamChanSize)
+	}
+}
+
+func TestCmdCloseStreams(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, CloseStreams: true},
+		"bash", "-c", "echo out; echo err >&2")
+	statusChan := p.Start()
+
+	var stdout, stderr []string
+
+	stdoutChan, stderrChan := p.Stdout, p.Stderr
+
+	for stdoutChan != nil || stderrChan != nil {
+		select {
+		case line, ok := <-stdoutChan:
+			if !ok {
+				stdoutChan = nil
+				break
+			}
+
+			stdout = append(stdout, line)
+		case line, ok := <-stderrChan:
+			if !ok {
+				stderrChan = nil
+				break
+			}
+
+			stderr = append(stderr, line)
+		}
+	}
+
+	// The final status is sent after the channels are closed
+	s := <-statusChan
+
+	if s.Exit != 0 {
+		t.Errorf("got exit %d, expected 0", s.Exit)
+	}
+
+	if diffs := deep.Equal(stdout, []string{"out"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if diffs := deep.Equal(stderr, []string{"err"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestCmdStreamingLastLine(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, CloseStreams: true},
+		"printf", "1\\nno newline")
+	p.Start()
+
+	var got []string
+	for line := range p.Stdout {
+		got = append(got, line)
+	}
+
+	if diffs := deep.Equal(got, []string{"1", "no newline"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestCmdCombinedOutput(t *testing.T) {
+	// Without sleeps, separate pipes could not keep this order
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, CombinedOutput: true},
+		"bash", "-c", "for i in 1 2 3; do echo out $i; echo err $i >&2; done; exit 2")
+	s := <-p.Start()
+
+	expect := []string{"out 1", "err 1", "out 2", "err 2", "out 3", "err 3"}
+	if diffs := deep.Equal(s.Combined, expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if len(s.Stdout) != 0 || len(s.Stderr) != 0 {
+		t.Errorf("got stdout %v and stderr %v, expected none", s.Stdout, s.Stderr)
+	}
+
+	var exitErr *cmd.ExitError
+	if !errors.As(s.Err(), &exitErr) {
+		t.Fatalf("got error %v, expected *cmd.ExitError", s.Err())
+	}
+
+	if diffs := deep.Equal(exitErr.StderrTail, expect); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestCmdCombinedSince(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{
+		Buffered:       true,
+		CombinedOutput: true,
+		OutputLimits:   cmd.OutputLimits{HeadLines: 1, TailLines: 2},
+	}, "bash", "-c", "seq 5; seq 6 10 >&2")
+	s := <-p.Start()
+
+	if s.CombinedTruncated != 7 || s.StdoutTruncated != 0 || s.StderrTruncated != 0 {
+		t.Errorf("got %d combined, %d stdout and %d stderr truncated lines, expected 7, 0 and 0",
+			s.CombinedTruncated, s.StdoutTruncated, s.StderrTruncated)
+	}
+
+	lines, next := p.CombinedSince(0)
+	if diffs := deep.Equal(lines, s.Combined); diffs != nil || next != 10 {
+		t.Errorf("got %v, %d, expected %v and 10", lines, next, s.Combined)
+	}
+
+	lines, next = p.CombinedSince(9)
+	if diffs := deep.Equal(lines, []string{"10"}); diffs != nil || next != 10 {
+		t.Errorf("got %v, %d, expected [10] and 10", lines, next)
+	}
+
+	if lines, _ := p.StdoutSince(0); len(lines) != 0 {
+		t.Errorf("got stdout %v, expected none", lines)
+	}
+
+	// Without CombinedOutput, there are no combined lines
+	p = cmd.NewCmd("echo", "foo")
+	<-p.Start()
+
+	if lines, next := p.CombinedSince(0); len(lines) != 0 || next != 0 {
+		t.Errorf("got %v, %d, expected no lines and 0", lines, next)
+	}
+}
+
+func TestCmdCombinedOutputStreaming(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, CombinedOutput: true, CloseStreams: true},
+		"bash", "-c", "echo out; echo err >&2")
+	p.Start()
+
+	var got []string
+	for line := range p.Stdout {
+		got = append(got, line)
+	}
+
+	if diffs := deep.Equal(got, []string{"out", "err"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// Nothing is sent to Stderr
+	for line := range p.Stderr {
+		t.Errorf("got stderr line %q", line)
+	}
+}
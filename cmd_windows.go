@@ -2,12 +2,21 @@ package cmd
 
 import (
 	"os/exec"
+	"syscall"
 )
 
 func SyscallKill(pid int) error {
 	return nil
 }
 
+func SyscallSignal(pid int, sig syscall.Signal) error {
+	return nil
+}
+
 func SetGroupID(cmd *exec.Cmd) {
 
 }
+
+func joinGroup(cmd *exec.Cmd, pgid int) {
+
+}
@@ -1,6 +1,10 @@
 package cmd
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+)
 
 // --------------------------------------------------------------------------
 
@@ -10,17 +14,114 @@ const (
 	// occur, try increasing the size by calling OutputBuffer.SetLineBufferSize.
 	DefaultLineBufferSize = 16384
 
+	// DefaultMaxLineBufferSize is the default maximum size the OutputStream line
+	// buffer grows to with the OverflowGrow policy.
+	DefaultMaxLineBufferSize = 1 << 20
+
 	// DefaultStreamChanSize is the default string channel size for a Cmd when
 	// Options.Streaming is true. The string channel size can have a minor
 	// performance impact if too small by causing OutputStream.Write to block
 	// excessively.
 	DefaultStreamChanSize = 1000
+
+	// ExitErrorTailLines is the maximum number of STDERR lines in
+	// ExitError.StderrTail.
+	ExitErrorTailLines = 10
 )
 
+var (
+	// ErrNotStarted is returned by Cmd.Signal when the command has not been
+	// started yet, so there is no process to signal.
+	ErrNotStarted = errors.New("command not started")
+
+	// ErrDone is returned by Cmd.Signal when the command has already finished,
+	// so there is no process to signal anymore.
+	ErrDone = errors.New("command already done")
+
+	// ErrNotSupported is returned by features that are not supported on the
+	// current platform, like reading process information from /proc.
+	ErrNotSupported = errors.New("not supported on this platform")
+
+	// ErrNoPTY is returned by Cmd.Resize when the command does not run in a
+	// pseudo-terminal.
+	ErrNoPTY = errors.New("command has no pseudo-terminal")
+
+	// ErrStdinClosed is returned when writing to Cmd.StdinWriter after it has
+	// been closed.
+	ErrStdinClosed = errors.New("stdin closed")
+
+	// ErrExpectTimeout is returned by Expecter.Expect and Expecter.ExpectAny when
+	// no pattern matched the output within the timeout.
+	ErrExpectTimeout = errors.New("expect timed out")
+
+	// ErrStdinDisabled is returned by Expecter.Send when STDIN of the command is
+	// read from Options.StdinReader.
+	ErrStdinDisabled = errors.New("stdin not enabled")
+)
+
+var (
+	// ErrTimeout is wrapped by the SignalError in Status.Error when the command
+	// was killed because Options.Timeout elapsed.
+	ErrTimeout = errors.New("command timed out")
+
+	// ErrStopped is wrapped by the SignalError in Status.Error when the command
+	// was ended by Cmd.Stop or Cmd.StopGracefully.
+	ErrStopped = errors.New("command stopped")
+)
+
+// SignalError is set to Status.Error when the command was ended by a signal.
+// Err is why the signal was sent, if known: ErrTimeout, ErrStopped or the error
+// of the context given to Cmd.StartContext. Use errors.Is to check it, like
+// errors.Is(status.Error, cmd.ErrTimeout).
+type SignalError struct {
+	Signal os.Signal
+	Err    error
+}
+
+func (e *SignalError) Error() string { return "signal: " + e.Signal.String() }
+
+// Unwrap returns the reason the signal was sent, or nil.
+func (e *SignalError) Unwrap() error { return e.Err }
+
+// StartError is set to Status.Error when the command failed to start. Err is
+// the error from os/exec.Cmd.Start, so errors.Is(status.Error, exec.ErrNotFound)
+// is true if the command was not found in PATH.
+type StartError struct {
+	Name string
+	Err  error
+}
+
+func (e *StartError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the error from os/exec.Cmd.Start.
+func (e *StartError) Unwrap() error { return e.Err }
+
+// ExitError is returned by Status.Err when the command exited non-zero. It is
+// also Status.Error if Options.ExitError is true; else Status.Error is nil.
+// StderrTail contains the last lines of buffered STDERR, if any, or of buffered
+// combined output with Options.CombinedOutput.
+type ExitError struct {
+	Code       int
+	StderrTail []string
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// ErrUnsupportedSignal is returned by Cmd.Signal when the signal is not a
+// syscall.Signal.
+type ErrUnsupportedSignal struct {
+	Signal os.Signal
+}
+
+func (e ErrUnsupportedSignal) Error() string {
+	return fmt.Sprintf("unsupported signal: %v", e.Signal)
+}
+
 // ErrLineBufferOverflow is returned by OutputStream.Write when the internal
 // line buffer is filled before a newline character is written to terminate a
 // line. Increasing the line buffer size by calling OutputStream.SetLineBufferSize
-// can help prevent this error.
+// or setting another policy by calling OutputStream.SetOverflowPolicy can help
+// prevent this error.
 type ErrLineBufferOverflow struct {
 	Line       string // Unterminated line that caused the error
 	BufferSize int    // Internal line buffer size
@@ -3,38 +3,48 @@ package main
 import (
 	"fmt"
 	"os"
-	"time"
+	"sync"
 
 	"github.com/gobars/cmd"
 )
 
 func main() {
-	// Disable output buffering, enable streaming
+	// Disable output buffering, enable streaming, and close the streaming
+	// channels when all output has been sent
 	cmdOptions := cmd.Options{
-		Buffered:  false,
-		Streaming: true,
+		Buffered:     false,
+		Streaming:    true,
+		CloseStreams: true,
 	}
 
 	// Create Cmd with options
 	envCmd := cmd.NewCmdOptions(cmdOptions, "env")
 
 	// Print STDOUT and STDERR lines streaming from Cmd
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
 	go func() {
-		for {
-			select {
-			case line := <-envCmd.Stdout:
-				fmt.Println(line)
-			case line := <-envCmd.Stderr:
-				fmt.Fprintln(os.Stderr, line)
-			}
+		defer wg.Done()
+
+		for line := range envCmd.Stdout {
+			fmt.Println(line)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for line := range envCmd.Stderr {
+			fmt.Fprintln(os.Stderr, line)
 		}
 	}()
 
 	// Run and wait for Cmd to return, discard Status
 	<-envCmd.Start()
 
-	// Cmd has finished but wait for goroutine to print all lines
-	for len(envCmd.Stdout) > 0 || len(envCmd.Stderr) > 0 {
-		time.Sleep(10 * time.Millisecond)
-	}
+	// Cmd has finished and its channels are closed, but wait for the goroutines
+	// to print the last lines they received
+	wg.Wait()
 }
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultExpectBufferSize is the default maximum number of bytes of output not
+// yet matched that an Expecter keeps. When more output is written before it is
+// matched, the oldest bytes are discarded.
+const DefaultExpectBufferSize = 65536
+
+// DefaultExpectTranscriptSize is the default maximum number of bytes of the
+// transcript that an Expecter keeps. When more is written, the oldest bytes are
+// discarded.
+const DefaultExpectTranscriptSize = 1048576
+
+// Expecter automates interactive commands, like expect(1): it waits for output
+// matching a pattern, then sends input. It matches raw output, not lines, so a
+// prompt that does not end with a newline, like "Password: ", can be matched as
+// soon as it is written. Both STDOUT and STDERR are matched. Consider
+// Options.PTY for commands that only prompt when run in a terminal.
+//
+//   c := cmd.NewCmdOptions(cmd.Options{PTY: true}, "mysql", "-p")
+//   e := cmd.NewExpecter(c)
+//   c.Start()
+//
+//   if _, err := e.Expect(regexp.MustCompile(`password: $`), 5*time.Second); err != nil {
+//       return err
+//   }
+//   e.SendLine(password)
+//
+// An Expecter is safe to use by multiple goroutines, but concurrent Expect
+// calls compete for the same output.
+type Expecter struct {
+	c *Cmd
+
+	mu             sync.Mutex
+	buf            []byte        // output not yet matched
+	bufSize        int           // maximum len(buf)
+	transcript     []byte        // latest output and input
+	transcriptSize int           // maximum len(transcript)
+	changed        chan struct{} // closed and replaced when output is written
+}
+
+// NewExpecter creates a new Expecter for the command. It must be called before
+// the command is started. It enables STDIN of the command if not enabled.
+func NewExpecter(c *Cmd) *Expecter {
+	e := &Expecter{
+		c:              c,
+		bufSize:        DefaultExpectBufferSize,
+		transcriptSize: DefaultExpectTranscriptSize,
+		changed:        make(chan struct{}),
+	}
+
+	if c.stdin == nil && c.stdinReader == nil {
+		c.Stdin = make(chan string)
+		c.stdin = &stdinWriter{}
+	}
+
+	c.outputTaps = append(c.outputTaps, e)
+
+	return e
+}
+
+// SetBufferSize sets the maximum number of bytes of output not yet matched.
+// The default is DefaultExpectBufferSize.
+func (e *Expecter) SetBufferSize(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.bufSize = n
+}
+
+// SetTranscriptSize sets the maximum number of bytes of the transcript. The
+// default is DefaultExpectTranscriptSize. Zero disables the transcript.
+func (e *Expecter) SetTranscriptSize(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.transcriptSize = n
+	e.transcript = appendTail(e.transcript, nil, n)
+}
+
+// Write makes Expecter implement the io.Writer interface. Do not call this
+// function directly.
+func (e *Expecter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.transcript = appendTail(e.transcript, p, e.transcriptSize)
+	e.buf = appendTail(e.buf, p, e.bufSize)
+
+	close(e.changed)
+	e.changed = make(chan struct{})
+
+	return len(p), nil
+}
+
+// Expect waits up to timeout for output matching re. It returns the text of the
+// match and its submatches, like regexp.Regexp.FindStringSubmatch. Output up to
+// the end of the match is consumed, so the next Expect only matches output
+// written after it. If no output matches within the timeout, it returns
+// ErrExpectTimeout. If the command ends and none of its remaining output
+// matches, it returns io.EOF.
+func (e *Expecter) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	_, match, err := e.ExpectAny(timeout, re)
+	return match, err
+}
+
+// ExpectAny is like Expect but waits for output matching any of cases. It
+// returns the index of the first case that matches, or -1 on error. Cases are
+// tried in order, so if more than one matches, the first one wins even if
+// another matches earlier output.
+func (e *Expecter) ExpectAny(timeout time.Duration, cases ...*regexp.Regexp) (int, []string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	done := false
+
+	for {
+		e.mu.Lock()
+
+		for i, re := range cases {
+			loc := re.FindSubmatchIndex(e.buf)
+			if loc == nil {
+				continue
+			}
+
+			match := make([]string, len(loc)/2)
+			for j := range match {
+				if loc[2*j] >= 0 {
+					match[j] = string(e.buf[loc[2*j]:loc[2*j+1]])
+				}
+			}
+
+			e.buf = append(e.buf[:0], e.buf[loc[1]:]...)
+			e.mu.Unlock()
+
+			return i, match, nil
+		}
+
+		changed := e.changed
+		e.mu.Unlock()
+
+		if done {
+			return -1, nil, io.EOF
+		}
+
+		select {
+		case <-changed:
+		case <-e.c.Done():
+			// All output is written before Done is closed, so try once more.
+			done = true
+		case <-timer.C:
+			return -1, nil, ErrExpectTimeout
+		}
+	}
+}
+
+// Send writes s to STDIN of the command as is.
+func (e *Expecter) Send(s string) error {
+	w := e.c.StdinWriter()
+	if w == nil {
+		return ErrStdinDisabled
+	}
+
+	e.mu.Lock()
+	e.transcript = appendTail(e.transcript, []byte(s), e.transcriptSize)
+	e.mu.Unlock()
+
+	_, err := io.WriteString(w, s)
+
+	return err
+}
+
+// SendLine writes s and a newline to STDIN of the command.
+func (e *Expecter) SendLine(s string) error { return e.Send(s + "\n") }
+
+// Transcript returns all output of the command and all input sent by Send and
+// SendLine so far, in the order they were written. Only the latest bytes are
+// kept, see SetTranscriptSize.
+func (e *Expecter) Transcript() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return string(e.transcript)
+}
+
+// appendTail appends p to buf and discards the oldest bytes over size.
+func appendTail(buf, p []byte, size int) []byte {
+	buf = append(buf, p...)
+
+	if over := len(buf) - size; over > 0 {
+		buf = append(buf[:0], buf[over:]...)
+	}
+
+	return buf
+}
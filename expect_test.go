@@ -0,0 +1,117 @@
+package cmd_test
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+const expectScript = `printf "name: "; read n; echo "hello $n"; printf "continue? [y/n] "; read a; [ "$a" = y ] && echo yes || echo no`
+
+func TestExpect(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", expectScript)
+	e := cmd.NewExpecter(p)
+	statusChan := p.Start()
+
+	// The prompt does not end with a newline
+	if _, err := e.Expect(regexp.MustCompile(`name: $`), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.SendLine("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := e.Expect(regexp.MustCompile(`hello (\w+)`), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diffs := deep.Equal(match, []string{"hello bob", "bob"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	i, _, err := e.ExpectAny(time.Second, regexp.MustCompile(`password: `), regexp.MustCompile(`\[y/n\] `))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i != 1 {
+		t.Errorf("got case %d, expected 1", i)
+	}
+
+	if err := e.Send("y\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Expect(regexp.MustCompile(`yes`), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	<-statusChan
+
+	// Output is consumed, so "hello" does not match again and the command ended
+	if _, err := e.Expect(regexp.MustCompile(`hello`), time.Second); err != io.EOF {
+		t.Errorf("got err %v, expected %v", err, io.EOF)
+	}
+
+	expectTranscript := "name: bob\nhello bob\ncontinue? [y/n] y\nyes\n"
+	if got := e.Transcript(); got != expectTranscript {
+		t.Errorf("got transcript %q, expected %q", got, expectTranscript)
+	}
+}
+
+func TestExpectTimeout(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", expectScript)
+	e := cmd.NewExpecter(p)
+	p.Start()
+
+	defer func() { _ = p.Stop() }()
+
+	start := time.Now()
+
+	if _, err := e.Expect(regexp.MustCompile(`password: `), 200*time.Millisecond); err != cmd.ErrExpectTimeout {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrExpectTimeout)
+	}
+
+	if d := time.Since(start); d < 200*time.Millisecond || d > time.Second {
+		t.Errorf("got timeout after %s, expected 200ms", d)
+	}
+
+	if !strings.HasPrefix(e.Transcript(), "name: ") {
+		t.Errorf("got transcript %q, expected prompt", e.Transcript())
+	}
+}
+
+func TestExpectTranscriptSize(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", `printf "name: "; read n; echo "hello $n"`)
+	e := cmd.NewExpecter(p)
+	e.SetTranscriptSize(12)
+	statusChan := p.Start()
+
+	if _, err := e.Expect(regexp.MustCompile(`name: $`), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.SendLine("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	<-statusChan
+
+	// Only the latest bytes of "name: bob\nhello bob\n" are kept
+	if got := e.Transcript(); got != "b\nhello bob\n" {
+		t.Errorf("got transcript %q, expected %q", got, "b\nhello bob\n")
+	}
+
+	e.SetTranscriptSize(0)
+
+	if got := e.Transcript(); got != "" {
+		t.Errorf("got transcript %q, expected none", got)
+	}
+}
@@ -1,6 +1,10 @@
 package cmd
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 )
@@ -18,6 +22,7 @@ type Cmd struct {
 	Stdin  chan string
 	Stdout chan string // streaming STDOUT if enabled, else nil (see Options)
 	Stderr chan string // streaming STDERR if enabled, else nil (see Options)
+	Lines  <-chan Line // streaming STDOUT and STDERR if enabled, else nil (see Options)
 
 	statusChan chan Status   // nil until Start() called
 	doneChan   chan struct{} // closed when done running
@@ -26,15 +31,70 @@ type Cmd struct {
 
 	started  bool // cmd.Start called, no error
 	stopped  bool // Stop called
-	done     bool // run() done
-	final    bool // status finalized in Status
-	buffered bool // buffer STDOUT and STDERR to Status.Stdout and Std
+	timedOut bool // killed because Options.Timeout elapsed
+
+	cancelErr error // StartContext context error if cancelled
+
+	outputTaps []io.Writer      // get raw STDOUT and STDERR, like an Expecter
+	hub        *outputHub       // fan-out of output lines to subscribers
+	progress   *progressTracker // latest repaint; see Progress
+	hubStdout  *hubWriter       // STDOUT to the hub
+	hubStderr  *hubWriter       // STDERR to the hub
+
+	pgid       int           // process group to join, if > 0; see Pipeline
+	pipeStdin  *os.File      // STDIN from the previous command of a Pipeline
+	pipeStdout *os.File      // STDOUT to the next command of a Pipeline
+	waitGate   chan struct{} // if not nil, the process is not reaped until closed
+
+	stdin       *stdinWriter // STDIN shared by Stdin and StdinWriter, nil if not enabled
+	stdinReader io.Reader    // Options.StdinReader
+
+	pty        bool          // run in a pseudo-terminal
+	windowSize WindowSize    // initial pseudo-terminal size
+	ptmx       *os.File      // pseudo-terminal master, if pty
+	tty        *os.File      // pseudo-terminal slave, if pty, closed after start
+	ptyOut     io.Writer     // output writer the master is copied to
+	ptyDone    chan struct{} // closed when all output is copied from the master
+	ptyExited  chan struct{} // closed when the command exits; see waitPTY
+	done       bool          // run() done
+	final      bool          // status finalized in Status
+	buffered   bool          // buffer STDOUT and STDERR to Status.Stdout and Std
+
+	outputLimits OutputLimits // bound the buffered output if set
 
 	startTime time.Time     // if started true
 	stdout    *OutputBuffer // low-level stdout buffering and streaming
 	stderr    *OutputBuffer // low-level stderr buffering and streaming
-	status    Status
-	timeout   time.Duration
+	combined  *OutputBuffer // buffered STDOUT and STDERR if Options.CombinedOutput
+
+	// Final lines of the buffers, which are released once the status is final.
+	// They share the lines of Status.Stdout, Status.Stderr and Status.Combined.
+	stdoutLines   outputSnapshot
+	stderrLines   outputSnapshot
+	combinedLines outputSnapshot
+
+	combinedOutput bool // Options.CombinedOutput
+
+	rawStdout   io.Writer  // Options.RawStdout
+	rawBuffered bool       // Options.RawBuffered
+	rawBuf      *rawBuffer // exact STDOUT bytes, released once the status is final
+
+	split        bufio.SplitFunc // Options.Split
+	progressMode ProgressMode    // Options.Progress
+	lineOverflow OverflowPolicy  // Options.LineOverflow
+	maxLineBuf   int             // Options.MaxLineBufferSize
+
+	streamPolicy StreamPolicy  // Options.StreamPolicy
+	closeStreams bool          // Options.CloseStreams
+	streamLines  bool          // Options.StreamLines
+	cancelLines  func()        // cancels the subscription of Lines
+	replay       bool          // Options.Replay
+	stdoutStream *OutputStream // streaming STDOUT if enabled
+	stderrStream *OutputStream // streaming STDERR if enabled
+	status       Status
+	timeout      time.Duration
+	killGrace    time.Duration
+	exitError    bool // Options.ExitError
 }
 
 // Status represents the running status and consolidated return of a Cmd. It can
@@ -52,17 +112,36 @@ type Cmd struct {
 // but was terminated unexpectedly (probably signaled). In either case, the
 // command failed. Callers should check Error first. If nil, then check Exit and
 // Complete.
+//
+// Reason tells why the command ended without having to infer it from the values
+// above. For example, a command killed because Options.Timeout elapsed has
+// Reason = ReasonTimedOut, whereas a command killed by someone else has
+// Reason = ReasonSignaled and Signal = SIGKILL.
 type Status struct {
-	Cmd      string
-	PID      int
-	Complete bool     // false if stopped or signaled
-	Exit     int      // exit code of process
-	Error    error    // Go error
-	StartTs  int64    // Unix ts (nanoseconds), zero if Cmd not started
-	StopTs   int64    // Unix ts (nanoseconds), zero if Cmd not started or running
-	Runtime  float64  // seconds, zero if Cmd not started
-	Stdout   []string // buffered STDOUT; see Cmd.Status for more info
-	Stderr   []string // buffered STDERR; see Cmd.Status for more info
+	Cmd       string
+	PID       int
+	Complete  bool      // false if stopped or signaled
+	Exit      int       // exit code of process
+	Signal    os.Signal // signal that ended the process, nil if it exited
+	Error     error     // Go error
+	Cancelled bool      // stopped because the StartContext context was done
+	Reason    Reason    // why the command ended, ReasonNone if not started or running
+	StartTs   int64     // Unix ts (nanoseconds), zero if Cmd not started
+	StopTs    int64     // Unix ts (nanoseconds), zero if Cmd not started or running
+	Runtime   float64   // seconds, zero if Cmd not started
+	Rusage    *Rusage   // resource usage, nil if Cmd not finished or not supported
+	Stdout    []string  // buffered STDOUT; see Cmd.Status for more info
+	Stderr    []string  // buffered STDERR; see Cmd.Status for more info
+	Lines     []Line    // buffered STDOUT and STDERR records; see Options.StreamLines
+	Combined  []string  // buffered STDOUT and STDERR; see Options.CombinedOutput
+
+	StdoutBytes []byte // exact STDOUT bytes, set when Cmd finishes; see Options.RawBuffered
+
+	StdoutTruncated   int // buffered STDOUT lines dropped or cut; see Options.OutputLimits
+	StderrTruncated   int // buffered STDERR lines dropped or cut; see Options.OutputLimits
+	CombinedTruncated int // buffered combined lines dropped or cut; see Options.CombinedOutput
+	StdoutDropped     int // streaming STDOUT lines dropped; see Options.StreamPolicy
+	StderrDropped     int // streaming STDERR lines dropped; see Options.StreamPolicy
 }
 
 // Options represents customizations for NewCmdOptions.
@@ -72,17 +151,203 @@ type Options struct {
 	// See Cmd.Status for more info.
 	Buffered bool
 
+	// If OutputLimits is set, buffered STDOUT and STDERR are each bounded: only
+	// the first and last lines are kept and Status.StdoutTruncated and
+	// Status.StderrTruncated count the lines dropped between them. See
+	// NewBoundedOutputBuffer. Use it for long-running or chatty commands that
+	// would otherwise grow the buffers without limit.
+	OutputLimits OutputLimits
+
+	// If CombinedOutput is true, STDERR is written to the same pipe as STDOUT,
+	// like 2>&1 in a shell, so output is in the exact order the command wrote
+	// it. Buffered output is written to Status.Combined instead of
+	// Status.Stdout and Status.Stderr, Status.CombinedTruncated counts its
+	// dropped lines and Cmd.CombinedSince reads it incrementally. Streaming
+	// output is sent to Cmd.Stdout only. Since the command writes both to one
+	// pipe, which lines were written to STDERR is unknown: all lines are
+	// StreamStdout (see Line). To tell STDOUT and STDERR lines apart, use
+	// Status.Lines or Cmd.Subscribe without CombinedOutput instead, which order
+	// lines by arrival from two pipes.
+	CombinedOutput bool
+
+	// If RawStdout is not nil, STDOUT is also written to it as is, without
+	// splitting it into lines, so binary output, like that of tar or gzip, is
+	// not corrupted. If RawBuffered is true, STDOUT is also kept as is in
+	// Status.StdoutBytes when the command finishes; Cmd.StdoutBytesSince reads
+	// it while the command is running. Status.StdoutBytes is not copied, so it
+	// must not be modified. Neither needs Buffered or Streaming. With
+	// CombinedOutput, STDERR is included too. A write error of RawStdout stops
+	// the output, like that of any writer, and is returned in Status.Error.
+	// Errors of the line output do not stop the raw output: with OverflowError,
+	// overlong streaming lines are split like with OverflowSplit instead, and
+	// other errors, like of a split function, only stop the line output.
+	RawStdout   io.Writer
+	RawBuffered bool
+
 	// If Streaming is true, Cmd.Stdout and Cmd.Stderr channels are created and
 	// STDOUT and STDERR output lines are written them in real time. This is
 	// faster and more efficient than polling Cmd.Status. The caller must read both
-	// streaming channels, else lines are dropped silently.
+	// streaming channels, else the command is stalled writing output until they
+	// are read, unless StreamPolicy is set.
 	Streaming bool
 
+	// StreamPolicy determines what happens to lines when a streaming channel is
+	// full because the caller does not read it fast enough. The default,
+	// StreamBlock, stalls the command. Lines dropped by StreamDropNewest and
+	// StreamDropOldest are counted in Status.StdoutDropped and
+	// Status.StderrDropped.
+	StreamPolicy StreamPolicy
+
+	// Split, if set, splits output into tokens instead of lines, like ScanNUL
+	// for NUL-terminated records, ScanCRLines for progress bars or ScanChunks
+	// for raw chunks. Each token is then a line of buffered and streaming
+	// output and a Line. See OutputBuffer.SetSplitFunc and
+	// OutputStream.SetSplitFunc.
+	Split bufio.SplitFunc
+
+	// Progress determines how lines repainted with "\r", like progress bars,
+	// are handled; see ProgressMode. If set, Cmd.Progress returns the latest
+	// repaint. Unless Split is set, it sets the split function of the output:
+	// ScanCRLines with ProgressEvents, or one that keeps the latest repaint of
+	// each line with ProgressLatest.
+	Progress ProgressMode
+
+	// LineOverflow determines what happens when a streaming line is longer than
+	// DefaultLineBufferSize. The default, OverflowError, stops streaming output
+	// (see ErrLineBufferOverflow). With OverflowGrow, MaxLineBufferSize is the
+	// maximum line buffer size; if zero, DefaultMaxLineBufferSize is used. It
+	// applies to tokens too, with Split or Progress.
+	LineOverflow      OverflowPolicy
+	MaxLineBufferSize int
+
+	// If StreamLines is true, the Cmd.Lines channel is created and STDOUT and
+	// STDERR output lines are written to it in real time as Line records, in
+	// the order they were written across both streams. StreamPolicy applies,
+	// except StreamSpill is the same as StreamBlock, and the channel is closed
+	// when the command finishes, before its final Status is sent. It is the
+	// same as a subscription that starts with the command; see Cmd.Subscribe.
+	// With Buffered, Status.Lines has the Line records too, bounded like
+	// SubscribeOptions.Replay.
+	StreamLines bool
+
+	// If Replay is true, lines of STDOUT and STDERR are kept as Line records,
+	// bounded by OutputLimits, so subscribers with SubscribeOptions.Replay get
+	// the lines written before they subscribed. Else, no lines are replayed.
+	Replay bool
+
+	// If CloseStreams is true, the Cmd.Stdout and Cmd.Stderr streaming channels
+	// are closed after the last lines are sent when the command finishes, and
+	// before its final Status is sent. The caller can then simply range over
+	// the channels and know that all output has been received. With
+	// StreamPolicy StreamSpill, the final Status is sent only after the caller
+	// receives all queued lines.
+	CloseStreams bool
+
 	// 是否激活标准输入
 	StdinEnabled bool
 
+	// If StdinReader is set, it is copied to STDIN of the command, like a file or
+	// the output of another stream. Cmd.Stdin and Cmd.StdinWriter are then not
+	// available. As with os/exec.Cmd.Stdin, if StdinReader is not an *os.File,
+	// the command is not finished until StdinReader returns EOF or an error.
+	StdinReader io.Reader
+
+	// If PTY is true, the command runs in a new session with a pseudo-terminal
+	// as its controlling terminal, STDIN, STDOUT and STDERR (Linux only). Tools
+	// that behave differently when not attached to a terminal, like colorized
+	// output or password prompts, then behave as if run interactively. A terminal
+	// has only one output, so STDERR is merged into STDOUT and, with the default
+	// terminal settings, STDIN is echoed to it. PTY implies StdinEnabled.
+	PTY bool
+
+	// WindowSize is the initial pseudo-terminal size if PTY is true. If zero,
+	// DefaultWindowSize is used. Call Cmd.Resize to change it.
+	WindowSize WindowSize
+
 	// Set timeout for execution
 	Timeout time.Duration
 
+	// If KillGrace is greater than zero, Cmd.Stop sends the process group a
+	// SIGKILL signal when the command is still running KillGrace after the
+	// SIGTERM signal.
+	KillGrace time.Duration
+
+	// If ExitError is true, Status.Error is an *ExitError when the command exits
+	// non-zero, like Status.Err returns, so errors.As(status.Error, &exitErr)
+	// works. Else, Status.Error is nil in that case, as the exit code is in
+	// Status.Exit.
+	ExitError bool
+
 	Env []string
 }
+
+// Err returns one error describing how the command failed, or nil if it
+// exited zero or has not finished. It is Status.Error if not nil, else an
+// *ExitError if the command exited non-zero. Unlike Status.Error, it is
+// suitable for error handling that does not need to check Exit separately.
+func (s Status) Err() error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	if s.Reason == ReasonNone || s.Exit <= 0 {
+		return nil
+	}
+
+	return newExitError(s.Exit, s.Stderr, s.Combined)
+}
+
+// newExitError returns an *ExitError with the last lines of stderr, or of
+// combined (Options.CombinedOutput) if stderr is empty.
+func newExitError(code int, stderr, combined []string) *ExitError {
+	tail := stderr
+	if len(tail) == 0 {
+		tail = combined
+	}
+
+	if len(tail) > ExitErrorTailLines {
+		tail = tail[len(tail)-ExitErrorTailLines:]
+	}
+
+	return &ExitError{Code: code, StderrTail: append([]string(nil), tail...)}
+}
+
+// Reason represents why a command ended. See Status.Reason.
+type Reason int
+
+const (
+	// ReasonNone means the command has not been started or is still running.
+	ReasonNone Reason = iota
+	// ReasonExited means the command exited by itself; see Status.Exit.
+	ReasonExited
+	// ReasonStopped means the command was ended by Cmd.Stop or Cmd.StopGracefully.
+	ReasonStopped
+	// ReasonTimedOut means the command was killed because Options.Timeout elapsed.
+	ReasonTimedOut
+	// ReasonSignaled means the command was ended by a signal not sent by Cmd.Stop,
+	// like the kernel OOM killer or Cmd.Signal; see Status.Signal.
+	ReasonSignaled
+	// ReasonStartFailed means the command failed to start; see Status.Error.
+	ReasonStartFailed
+	// ReasonContextCancelled means the command was stopped because the context
+	// given to Cmd.StartContext was done.
+	ReasonContextCancelled
+)
+
+var reasonNames = []string{
+	ReasonNone:             "none",
+	ReasonExited:           "exited",
+	ReasonStopped:          "stopped",
+	ReasonTimedOut:         "timed out",
+	ReasonSignaled:         "signaled",
+	ReasonStartFailed:      "start failed",
+	ReasonContextCancelled: "context cancelled",
+}
+
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(reasonNames) {
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+
+	return reasonNames[r]
+}
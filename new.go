@@ -32,6 +32,8 @@ func NewCmd(cmdparts ...string) *Cmd {
 			Runtime:  0,
 		},
 		doneChan: make(chan struct{}),
+		hub:      newOutputHub(),
+		progress: newProgressTracker(),
 	}
 }
 
@@ -46,15 +48,61 @@ func NewCmdOptions(options Options, cmdparts ...string) *Cmd {
 
 func (c *Cmd) applyOption(options Options) {
 	c.buffered = options.Buffered
+	c.outputLimits = options.OutputLimits
+	c.combinedOutput = options.CombinedOutput
+	c.rawStdout = options.RawStdout
+	c.rawBuffered = options.RawBuffered
+
+	if options.RawBuffered {
+		c.rawBuf = newRawBuffer()
+	}
 	if options.Streaming {
 		c.Stdout = make(chan string, DefaultStreamChanSize)
 		c.Stderr = make(chan string, DefaultStreamChanSize)
 	}
 
+	c.streamPolicy = options.StreamPolicy
+	c.closeStreams = options.CloseStreams
+	c.split = options.Split
+	c.progressMode = options.Progress
+
+	if c.split == nil {
+		switch c.progressMode {
+		case ProgressEvents:
+			c.split = ScanCRLines
+		case ProgressLatest:
+			c.split = scanLatestLines
+		}
+	}
+
+	c.lineOverflow = options.LineOverflow
+	c.maxLineBuf = options.MaxLineBufferSize
+
+	c.replay = options.Replay
+	// Options can be applied more than once, so cancel the subscription of
+	// Lines first; else no one would read it and it would stall the command.
+	if c.cancelLines != nil {
+		c.cancelLines()
+		c.Lines, c.cancelLines = nil, nil
+	}
+
+	c.streamLines = options.StreamLines
+	if c.streamLines {
+		c.Lines, c.cancelLines = c.Subscribe(SubscribeOptions{Policy: options.StreamPolicy})
+	}
+
 	c.timeout = options.Timeout
+	c.killGrace = options.KillGrace
+	c.exitError = options.ExitError
+
+	c.pty = options.PTY
+	c.windowSize = options.WindowSize
+
+	c.stdinReader = options.StdinReader
 
-	if options.StdinEnabled {
+	if (options.StdinEnabled || options.PTY) && options.StdinReader == nil {
 		c.Stdin = make(chan string)
+		c.stdin = &stdinWriter{}
 	}
 
 	c.Env = options.Env
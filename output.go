@@ -2,7 +2,7 @@ package cmd
 
 import (
 	"bufio"
-	"bytes"
+	"fmt"
 	"sync"
 )
 
@@ -21,8 +21,9 @@ import (
 
 // OutputBuffer represents command output that is saved, line by line, in an
 // unbounded buffer. It is safe for multiple goroutines to read while the command
-// is running and after it has finished. If output is small (a few megabytes)
-// and not read frequently, an output buffer is a good solution.
+// is running and after it has finished. Output is split into lines as it is
+// written, so reading lines is cheap and does not block the command writing more
+// output.
 //
 // A Cmd in this package uses an OutputBuffer for both STDOUT and STDERR by
 // default when created by calling NewCmd. To use OutputBuffer directly with
@@ -35,18 +36,53 @@ import (
 //   runnableCmd.Stdout = stdout
 //
 // While runnableCmd is running, call stdout.Lines() to read all output
-// currently written.
+// currently written. After runnableCmd.Wait returns, call stdout.Flush() to
+// add the last line if it does not end with a newline.
+//
+// For long-running or chatty commands, use NewBoundedOutputBuffer instead to
+// keep only the first and last lines of output.
 type OutputBuffer struct {
-	buf   *bytes.Buffer
-	lines []string
+	lines []string // all lines, or the head lines if bounded
+	split lineSplitter
 	*sync.Mutex
+
+	limits    OutputLimits
+	tail      []string // lines after the head lines, if bounded
+	tailBytes int      // length of tail lines, if bounded
+	truncated int      // lines dropped between the head and tail lines
+}
+
+// TruncationMarker is the format of the line inserted by a bounded OutputBuffer
+// between the first and last lines of output when lines were dropped. Its only
+// verb is the number of dropped lines.
+var TruncationMarker = "... %d lines truncated ..."
+
+// OutputLimits bounds the output kept by an OutputBuffer. See
+// NewBoundedOutputBuffer. The zero value means unbounded.
+type OutputLimits struct {
+	// HeadLines is the number of first lines of output to keep.
+	HeadLines int
+
+	// TailLines is the maximum number of last lines of output to keep, after
+	// the head lines. Zero means no limit on the number of lines, in which case
+	// MaxBytes should be set.
+	TailLines int
+
+	// MaxBytes is the maximum length of the last lines of output to keep,
+	// without newlines. The last line is always kept. Zero means no limit on the
+	// length, in which case TailLines should be set.
+	MaxBytes int
+}
+
+// bounded returns true if limits bound the output.
+func (l OutputLimits) bounded() bool {
+	return l.HeadLines > 0 || l.TailLines > 0 || l.MaxBytes > 0
 }
 
 // NewOutputBuffer creates a new output buffer. The buffer is unbounded and safe
 // for multiple goroutines to read while the command is running by calling Lines.
 func NewOutputBuffer() *OutputBuffer {
 	out := &OutputBuffer{
-		buf:   &bytes.Buffer{},
 		lines: []string{},
 		Mutex: &sync.Mutex{},
 	}
@@ -54,27 +90,194 @@ func NewOutputBuffer() *OutputBuffer {
 	return out
 }
 
+// NewBoundedOutputBuffer creates a new output buffer that keeps at most the
+// first limits.HeadLines lines and the last lines of output within
+// limits.TailLines and limits.MaxBytes. Lines between them are dropped and
+// counted (see Truncated), and Lines returns a TruncationMarker line in their
+// place. If only HeadLines is set, no last lines are kept.
+//
+// One line is bounded too, so output without newlines does not grow the buffer
+// either: a line longer than DefaultMaxLineBufferSize, or limits.MaxBytes if
+// greater, is cut at that length, followed by LineTruncationMarker, and counted
+// by Truncated. If limits is the zero value, the buffer is unbounded like one
+// created by NewOutputBuffer.
+func NewBoundedOutputBuffer(limits OutputLimits) *OutputBuffer {
+	out := NewOutputBuffer()
+	out.limits = limits
+
+	if limits.bounded() {
+		out.split.max = maxInt(limits.MaxBytes, DefaultMaxLineBufferSize)
+	}
+
+	return out
+}
+
 // Write makes OutputBuffer implement the io.Writer interface. Do not call
 // this function directly.
 func (rw *OutputBuffer) Write(p []byte) (n int, err error) {
 	rw.Lock()
 	defer rw.Unlock()
 
-	return rw.buf.Write(p) // and bytes.Buffer implements io.Writer
+	if err := rw.split.write(p, rw.addLine); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
 }
 
-// Lines returns lines of output written by the Cmd. It is safe to call while
-// the Cmd is running and after it has finished. Subsequent calls returns more
-// lines, if more lines were written. "\r\n" are stripped from the lines.
-func (rw *OutputBuffer) Lines() []string {
+// SetSplitFunc sets a bufio.SplitFunc to split output into tokens instead of
+// lines, like ScanNUL for NUL-terminated records. Each token is then a line
+// returned by Lines. If the split function returns an error, Write returns it.
+// This function must be called immediately after NewOutputBuffer, before the
+// first write.
+func (rw *OutputBuffer) SetSplitFunc(split bufio.SplitFunc) {
+	rw.Lock()
+	defer rw.Unlock()
+
+	rw.split.fn = split
+}
+
+// Flush adds the pending last line of output, if any. The last line is pending
+// until its newline is written, so call Flush when the output ends without a
+// newline, like after os/exec.Cmd.Wait returns. A Cmd calls Flush when the
+// command ends.
+func (rw *OutputBuffer) Flush() {
 	rw.Lock()
 	defer rw.Unlock()
-	// Scanners are io.Readers which effectively destroy the buffer by reading
-	// to EOF. So once we scan the buf to lines, the buf is empty again.
-	s := bufio.NewScanner(rw.buf)
-	for s.Scan() {
-		rw.lines = append(rw.lines, s.Text())
+
+	rw.split.flush(rw.addLine)
+}
+
+// addLine adds one line of output. The caller must hold the lock.
+//
+// Lines are never modified once added, only appended or dropped by re-slicing,
+// so readers can copy a snapshot of the slices without holding the lock.
+func (rw *OutputBuffer) addLine(line string) {
+	if !rw.limits.bounded() || len(rw.lines) < rw.limits.HeadLines {
+		rw.lines = append(rw.lines, line)
+		return
+	}
+
+	rw.tail = append(rw.tail, line)
+	rw.tailBytes += len(line)
+
+	for len(rw.tail) > 0 && rw.limits.tailFull(len(rw.tail), rw.tailBytes) {
+		rw.tailBytes -= len(rw.tail[0])
+		rw.tail = rw.tail[1:]
+		rw.truncated++
+	}
+}
+
+// tailFull returns true if lines last lines of length bytes, kept after the
+// head lines, exceed the limits and the oldest one must be dropped.
+func (l OutputLimits) tailFull(lines, bytes int) bool {
+	switch {
+	case l.TailLines == 0 && l.MaxBytes == 0:
+		return true // only head lines are kept
+	case l.TailLines > 0 && lines > l.TailLines:
+		return true
+	case l.MaxBytes > 0 && lines > 1:
+		return bytes > l.MaxBytes
+	default:
+		return false
+	}
+}
+
+// outputSnapshot is the lines of an OutputBuffer at one point in time.
+type outputSnapshot struct {
+	head      []string
+	tail      []string
+	truncated int
+}
+
+// snapshot returns the current lines. It only holds the lock to copy the slice
+// headers, so writers are not blocked while readers copy the lines.
+func (rw *OutputBuffer) snapshot() outputSnapshot {
+	rw.Lock()
+	defer rw.Unlock()
+
+	// Capping the capacity prevents callers appending to the returned lines
+	// from overwriting lines added later.
+	return outputSnapshot{
+		head:      rw.lines[:len(rw.lines):len(rw.lines)],
+		tail:      rw.tail[:len(rw.tail):len(rw.tail)],
+		truncated: rw.truncated,
+	}
+}
+
+// Truncated returns the number of lines dropped or cut by a bounded buffer. It
+// is always zero for an unbounded buffer.
+func (rw *OutputBuffer) Truncated() int {
+	rw.Lock()
+	defer rw.Unlock()
+
+	return rw.truncated + rw.split.truncated
+}
+
+// Lines returns lines of output written by the Cmd. It is safe to call while
+// the Cmd is running and after it has finished. Subsequent calls returns more
+// lines, if more lines were written. "\r\n" are stripped from the lines. The
+// last line is not returned until its newline is written or Flush is called.
+// The returned lines must not be modified.
+func (rw *OutputBuffer) Lines() []string { return rw.snapshot().lines() }
+
+// lines returns the lines of the snapshot like OutputBuffer.Lines.
+func (s outputSnapshot) lines() []string {
+	if s.truncated == 0 && len(s.tail) == 0 {
+		return s.head
+	}
+
+	lines := make([]string, 0, len(s.head)+1+len(s.tail))
+	lines = append(lines, s.head...)
+
+	if s.truncated > 0 {
+		lines = append(lines, fmt.Sprintf(TruncationMarker, s.truncated))
+	}
+
+	return append(lines, s.tail...)
+}
+
+// LinesSince returns the lines of output written after the first offset lines,
+// and the offset to pass to the next call to get only newer lines. Start with
+// offset zero. It is meant for callers that poll output, like a UI refreshing
+// every second, which then only copy new lines instead of all lines each time.
+//
+// Offsets count all lines written, including the lines dropped by a bounded
+// buffer. If lines after offset were dropped, a TruncationMarker line with the
+// number of lines missed is returned in their place.
+func (rw *OutputBuffer) LinesSince(offset int) (lines []string, next int) {
+	return rw.snapshot().linesSince(offset)
+}
+
+// linesSince returns the lines of the snapshot like OutputBuffer.LinesSince.
+func (s outputSnapshot) linesSince(offset int) (lines []string, next int) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	head := len(s.head)
+	tailStart := head + s.truncated
+	next = tailStart + len(s.tail)
+
+	if offset >= next {
+		return nil, next
+	}
+
+	if offset < head {
+		lines = append(lines, s.head[offset:]...)
+	}
+
+	if missed := tailStart - maxInt(offset, head); missed > 0 {
+		lines = append(lines, fmt.Sprintf(TruncationMarker, missed))
+	}
+
+	return append(lines, s.tail[maxInt(offset-tailStart, 0):]...), next
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
 	}
 
-	return rw.lines
+	return b
 }
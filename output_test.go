@@ -0,0 +1,357 @@
+package cmd_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func TestOutputBufferBounded(t *testing.T) {
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{HeadLines: 2, TailLines: 2})
+
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\r\n", "5\n", "6\n", "7"} {
+		if _, err := out.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The last line is not complete yet
+	expect := []string{"1", "2", "... 2 lines truncated ...", "5", "6"}
+	if diffs := deep.Equal(out.Lines(), expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if _, err := out.Write([]byte("\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expect = []string{"1", "2", "... 3 lines truncated ...", "6", "7"}
+	if diffs := deep.Equal(out.Lines(), expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if n := out.Truncated(); n != 3 {
+		t.Errorf("got %d truncated lines, expected 3", n)
+	}
+}
+
+func TestOutputBufferBoundedBytes(t *testing.T) {
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{MaxBytes: 6})
+
+	if _, err := out.Write([]byte("aa\nbb\ncc\nlonger than six\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last line is kept even if it alone exceeds MaxBytes
+	expect := []string{"... 3 lines truncated ...", "longer than six"}
+	if diffs := deep.Equal(out.Lines(), expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if _, err := out.Write([]byte("dd\nee\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expect = []string{"... 4 lines truncated ...", "dd", "ee"}
+	if diffs := deep.Equal(out.Lines(), expect); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputBufferBoundedHeadOnly(t *testing.T) {
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{HeadLines: 1})
+
+	if _, err := out.Write([]byte("1\n2\n3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"1", "... 2 lines truncated ..."}
+	if diffs := deep.Equal(out.Lines(), expect); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputBufferBoundedNotTruncated(t *testing.T) {
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{HeadLines: 2, TailLines: 2})
+
+	if _, err := out.Write([]byte("1\n2\n3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"1", "2", "3"}
+	if diffs := deep.Equal(out.Lines(), expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if n := out.Truncated(); n != 0 {
+		t.Errorf("got %d truncated lines, expected 0", n)
+	}
+}
+
+func TestOutputBufferLinesSince(t *testing.T) {
+	out := cmd.NewOutputBuffer()
+
+	lines, next := out.LinesSince(0)
+	if len(lines) != 0 || next != 0 {
+		t.Errorf("got %v, %d, expected no lines and 0", lines, next)
+	}
+
+	if _, err := out.Write([]byte("1\n2\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, next = out.LinesSince(next)
+	if diffs := deep.Equal(lines, []string{"1", "2"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if _, err := out.Write([]byte("3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, next = out.LinesSince(next)
+	if diffs := deep.Equal(lines, []string{"3"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if next != 3 {
+		t.Errorf("got next %d, expected 3", next)
+	}
+
+	lines, next = out.LinesSince(next)
+	if len(lines) != 0 || next != 3 {
+		t.Errorf("got %v, %d, expected no lines and 3", lines, next)
+	}
+}
+
+func TestOutputBufferLinesSinceBounded(t *testing.T) {
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{HeadLines: 2, TailLines: 2})
+
+	if _, err := out.Write([]byte("1\n2\n3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, next := out.LinesSince(1)
+	if diffs := deep.Equal(lines, []string{"2", "3"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// 4 is dropped before it's read
+	if _, err := out.Write([]byte("4\n5\n6\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, next = out.LinesSince(next)
+	if diffs := deep.Equal(lines, []string{"... 1 lines truncated ...", "5", "6"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if next != 6 {
+		t.Errorf("got next %d, expected 6", next)
+	}
+
+	// Offset zero returns the same lines as Lines
+	lines, _ = out.LinesSince(0)
+	if diffs := deep.Equal(lines, out.Lines()); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputBufferPartialLine(t *testing.T) {
+	out := cmd.NewOutputBuffer()
+
+	if _, err := out.Write([]byte("1\nhel")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The partial line is pending until its newline
+	if diffs := deep.Equal(out.Lines(), []string{"1"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if _, err := out.Write([]byte("lo\r\nwor")); err != nil {
+		t.Fatal(err)
+	}
+
+	if diffs := deep.Equal(out.Lines(), []string{"1", "hello"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// At EOF, the last line is complete even without a newline
+	out.Flush()
+
+	if diffs := deep.Equal(out.Lines(), []string{"1", "hello", "wor"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// Nothing is pending, so nothing more is added
+	out.Flush()
+
+	if diffs := deep.Equal(out.Lines(), []string{"1", "hello", "wor"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputBufferLongLine(t *testing.T) {
+	// Longer than the default bufio.Scanner token size
+	long := strings.Repeat("x", 100*1024)
+	out := cmd.NewOutputBuffer()
+
+	if _, err := out.Write([]byte(long + "\nend\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if diffs := deep.Equal(out.Lines(), []string{long, "end"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputBufferBoundedLongLine(t *testing.T) {
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{TailLines: 2})
+
+	// Written in chunks without a newline, the pending line is cut
+	chunk := []byte(strings.Repeat("x", 64*1024))
+	for i := 0; i < 100; i++ {
+		if _, err := out.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := out.Write([]byte("\r\nend\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("x", cmd.DefaultMaxLineBufferSize) + cmd.LineTruncationMarker
+	if diffs := deep.Equal(out.Lines(), []string{long, "end"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if n := out.Truncated(); n != 1 {
+		t.Errorf("got %d truncated lines, expected 1", n)
+	}
+
+	// The pending last line is cut too
+	if _, err := out.Write([]byte(strings.Repeat("y", cmd.DefaultMaxLineBufferSize+1))); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Flush()
+
+	long = strings.Repeat("y", cmd.DefaultMaxLineBufferSize) + cmd.LineTruncationMarker
+	if diffs := deep.Equal(out.Lines(), []string{"... 1 lines truncated ...", "end", long}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// One line dropped and two cut
+	if n := out.Truncated(); n != 3 {
+		t.Errorf("got %d truncated lines, expected 3", n)
+	}
+}
+
+func TestOutputBufferConcurrentReads(t *testing.T) {
+	out := cmd.NewOutputBuffer()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 1000; i++ {
+			_, _ = out.Write([]byte("line\n"))
+		}
+	}()
+
+	next := 0
+
+	for next < 1000 {
+		lines := out.Lines()
+		// Lines returned earlier are not changed by later writes
+		for _, line := range lines {
+			if line != "line" {
+				t.Fatalf("got line %q, expected \"line\"", line)
+			}
+		}
+
+		_, next = out.LinesSince(next)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkOutputBufferWrite(b *testing.B) {
+	chunk := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100))
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+
+	out := cmd.NewOutputBuffer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = out.Write(chunk)
+	}
+}
+
+func BenchmarkOutputBufferWriteBounded(b *testing.B) {
+	chunk := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100))
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+
+	out := cmd.NewBoundedOutputBuffer(cmd.OutputLimits{HeadLines: 100, TailLines: 1000})
+
+	for i := 0; i < b.N; i++ {
+		_, _ = out.Write(chunk)
+	}
+}
+
+// BenchmarkOutputBufferWriteWhileReading measures write throughput of a
+// high-volume command while another goroutine polls all lines, like Cmd.Status.
+func BenchmarkOutputBufferWriteWhileReading(b *testing.B) {
+	chunk := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100))
+
+	b.SetBytes(int64(len(chunk)))
+	b.ReportAllocs()
+
+	out := cmd.NewOutputBuffer()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = out.Lines()
+			}
+		}
+	}()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = out.Write(chunk)
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkOutputBufferLines(b *testing.B) {
+	out := cmd.NewOutputBuffer()
+	_, _ = out.Write([]byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100000)))
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = out.Lines()
+	}
+}
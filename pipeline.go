@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// Pipeline represents commands connected like a shell pipeline, cmd1 | cmd2 |
+// cmd3, but without a shell: STDOUT of each command is connected to STDIN of
+// the next one with an OS pipe. STDOUT of the last command and STDERR of all
+// commands are buffered or streamed per the options of each Cmd. All commands
+// run in the process group of the first one, so Stop stops all of them and
+// their children.
+//
+//   p := cmd.NewPipeline(
+//       cmd.NewCmd("find", ".", "-name", "*.go"),
+//       cmd.NewCmd("xargs", "grep", "-l", "TODO"),
+//       cmd.NewCmd("sort"),
+//   )
+//   status := <-p.Start()
+//   lines := status.Stages[2].Stdout
+//
+// The commands must be new and must not use Options.PTY. Do not call Start or
+// Stop on them directly; Stop of any command stops the whole pipeline.
+type Pipeline struct {
+	Cmds []*Cmd
+
+	*sync.Mutex
+
+	statusChan chan PipelineStatus // nil until Start() called
+	doneChan   chan struct{}       // closed when all commands are done
+	pgid       int                 // process group of all commands
+	err        error               // error creating the pipes
+}
+
+// PipelineStatus represents the status of a Pipeline. Exit, Complete and Error
+// follow the semantics of a shell with "set -o pipefail": the pipeline fails if
+// any command fails, and the rightmost failure wins. Like in a shell, a command
+// ended by a signal fails with exit code 128 + the signal number, like 141 for
+// a command killed by SIGPIPE because the next command exited early.
+type PipelineStatus struct {
+	Stages   []Status // Status of each command, in order
+	Complete bool     // true if all commands completed
+	Exit     int      // exit code of the rightmost command that failed, else 0
+	Error    error    // rightmost non-nil Status.Error, or an error creating the pipes
+}
+
+// Err is like Status.Err: it returns one error describing how the pipeline
+// failed, or nil. It is Error if not nil, else the error of the rightmost
+// command that failed.
+func (s PipelineStatus) Err() error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i := len(s.Stages) - 1; i >= 0; i-- {
+		if err := s.Stages[i].Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewPipeline creates a new Pipeline of the given commands. The pipeline is not
+// started until Start is called.
+func NewPipeline(cmds ...*Cmd) *Pipeline {
+	return &Pipeline{
+		Cmds:     cmds,
+		Mutex:    &sync.Mutex{},
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Start starts all commands and immediately returns a channel to which the final
+// PipelineStatus is sent when all commands have ended. Like Cmd.Start, it is
+// idempotent; it always returns the same channel.
+func (p *Pipeline) Start() <-chan PipelineStatus { return p.StartContext(context.Background()) }
+
+// StartContext is like Start but ties the lifetime of all commands to ctx, like
+// Cmd.StartContext: if ctx is done before they end, they are stopped the same
+// way Stop stops them and their Status.Cancelled is true. If ctx is already
+// done, no command is started. Only the context of the first call is used.
+func (p *Pipeline) StartContext(ctx context.Context) <-chan PipelineStatus {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.statusChan != nil {
+		return p.statusChan
+	}
+
+	p.statusChan = make(chan PipelineStatus, 1)
+
+	readers, writers, err := makePipes(len(p.Cmds) - 1)
+	if err != nil {
+		p.err = err
+
+		go p.wait()
+
+		return p.statusChan
+	}
+
+	// The first command leads the process group. If it exits before the others
+	// have started and is reaped, the group no longer exists and they cannot
+	// join it, so no command is reaped until all have started.
+	gate := make(chan struct{})
+
+	for i, c := range p.Cmds {
+		if i > 0 {
+			c.pipeStdin = readers[i-1]
+		}
+
+		if i < len(p.Cmds)-1 {
+			c.pipeStdout = writers[i]
+		}
+
+		c.pgid = p.pgid
+		c.waitGate = gate
+		c.StartContext(ctx) // returns after the process has started
+
+		// The first command that starts leads the process group, usually the
+		// first one, unless it could not start.
+		if p.pgid == 0 {
+			p.pgid = c.Status().PID
+		}
+
+		// Close our copies of the pipes so each command gets EOF or EPIPE
+		// when the other end exits.
+		if i > 0 {
+			_ = readers[i-1].Close()
+		}
+
+		if i < len(p.Cmds)-1 {
+			_ = writers[i].Close()
+		}
+	}
+
+	close(gate)
+
+	go p.wait()
+
+	return p.statusChan
+}
+
+// makePipes creates n OS pipes.
+func makePipes(n int) (readers, writers []*os.File, err error) {
+	for i := 0; i < n; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for j := range readers {
+				_ = readers[j].Close()
+				_ = writers[j].Close()
+			}
+
+			return nil, nil, err
+		}
+
+		readers = append(readers, r)
+		writers = append(writers, w)
+	}
+
+	return readers, writers, nil
+}
+
+func (p *Pipeline) wait() {
+	if p.err == nil {
+		for _, c := range p.Cmds {
+			<-c.Done()
+		}
+	}
+
+	p.statusChan <- p.Status()
+	close(p.doneChan)
+}
+
+// Stop stops all commands by sending their process group a SIGTERM signal. Like
+// Cmd.Stop, it is idempotent.
+func (p *Pipeline) Stop() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.statusChan == nil || p.pgid == 0 {
+		return nil
+	}
+
+	running := false
+
+	for _, c := range p.Cmds {
+		c.Lock()
+
+		if c.started && !c.done {
+			c.markStopped()
+
+			running = true
+		}
+
+		c.Unlock()
+	}
+
+	if !running {
+		return nil
+	}
+
+	return SyscallKill(-p.pgid)
+}
+
+// Status returns the PipelineStatus at any time. It is safe to call
+// concurrently by multiple goroutines.
+func (p *Pipeline) Status() PipelineStatus {
+	p.Lock()
+	err := p.err
+	p.Unlock()
+
+	s := PipelineStatus{
+		Stages:   make([]Status, len(p.Cmds)),
+		Complete: err == nil,
+		Error:    err,
+	}
+
+	for i, c := range p.Cmds {
+		s.Stages[i] = c.Status()
+
+		if !s.Stages[i].Complete {
+			s.Complete = false
+		}
+
+		if exit := shellExit(s.Stages[i]); exit > 0 {
+			s.Exit = exit
+		}
+
+		if s.Stages[i].Error != nil && err == nil {
+			s.Error = s.Stages[i].Error
+		}
+	}
+
+	return s
+}
+
+// shellExit returns the exit code of the command like a shell: 128 + the signal
+// number if it was ended by a signal.
+func shellExit(s Status) int {
+	if sig, ok := s.Signal.(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+
+	return s.Exit
+}
+
+// Done returns a channel that's closed when all commands have stopped running.
+func (p *Pipeline) Done() <-chan struct{} { return p.doneChan }
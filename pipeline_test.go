@@ -0,0 +1,230 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func TestPipeline(t *testing.T) {
+	p := cmd.NewPipeline(
+		cmd.NewCmd("printf", `b\na\nb\n`),
+		cmd.NewCmd("sort"),
+		cmd.NewCmd("uniq"),
+	)
+	gotStatus := <-p.Start()
+
+	if !gotStatus.Complete || gotStatus.Exit != 0 || gotStatus.Err() != nil {
+		t.Errorf("got Complete %v, Exit %d, Err %v, expected true, 0, nil",
+			gotStatus.Complete, gotStatus.Exit, gotStatus.Err())
+	}
+
+	if len(gotStatus.Stages) != 3 {
+		t.Fatalf("got %d stages, expected 3", len(gotStatus.Stages))
+	}
+
+	// Only the last command has STDOUT, the others write to the pipe
+	for i, expectStdout := range [][]string{{}, {}, {"a", "b"}} {
+		if diffs := deep.Equal(gotStatus.Stages[i].Stdout, expectStdout); diffs != nil {
+			t.Errorf("stage %d: %v", i, diffs)
+		}
+	}
+
+	// Start is idempotent, and Status is final after Done
+	<-p.Done()
+
+	if diffs := deep.Equal(p.Status(), gotStatus); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestPipelineFail(t *testing.T) {
+	// Like "set -o pipefail", the rightmost failure wins
+	p := cmd.NewPipeline(
+		cmd.NewCmd("bash", "-c", "echo a; exit 3"),
+		cmd.NewCmd("bash", "-c", "cat; exit 4"),
+		cmd.NewCmd("cat"),
+	)
+	gotStatus := <-p.Start()
+
+	if gotStatus.Exit != 4 {
+		t.Errorf("got Exit %d, expected 4", gotStatus.Exit)
+	}
+
+	var exitErr *cmd.ExitError
+	if !errors.As(gotStatus.Err(), &exitErr) || exitErr.Code != 4 {
+		t.Errorf("got err %v, expected exit status 4", gotStatus.Err())
+	}
+
+	if diffs := deep.Equal(gotStatus.Stages[2].Stdout, []string{"a"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// A command that is not found does not block the others
+	p = cmd.NewPipeline(cmd.NewCmd("cmd-does-not-exist"), cmd.NewCmd("cat"))
+	gotStatus = <-p.Start()
+
+	var startErr *cmd.StartError
+	if !errors.As(gotStatus.Error, &startErr) || gotStatus.Stages[0].Reason != cmd.ReasonStartFailed {
+		t.Errorf("got %+v, expected start failed", gotStatus.Stages[0])
+	}
+
+	if gotStatus.Complete || gotStatus.Stages[1].Exit != 0 {
+		t.Errorf("got Complete %v, cat Exit %d, expected false, 0", gotStatus.Complete, gotStatus.Stages[1].Exit)
+	}
+}
+
+func TestPipelineSignaled(t *testing.T) {
+	// A command killed by SIGPIPE in the middle fails the pipeline, like in a
+	// shell with "set -o pipefail"
+	p := cmd.NewPipeline(
+		cmd.NewCmd("echo", "a"),
+		cmd.NewCmd("bash", "-c", "cat; while :; do echo y; done"),
+		cmd.NewCmd("head", "-1"),
+	)
+	gotStatus := <-p.Start()
+
+	if gotStatus.Stages[1].Signal != syscall.SIGPIPE {
+		t.Errorf("got signal %v, expected %v", gotStatus.Stages[1].Signal, syscall.SIGPIPE)
+	}
+
+	if expect := 128 + int(syscall.SIGPIPE); gotStatus.Exit != expect {
+		t.Errorf("got Exit %d, expected %d", gotStatus.Exit, expect)
+	}
+
+	if diffs := deep.Equal(gotStatus.Stages[2].Stdout, []string{"a"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestPipelineStartContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := cmd.NewPipeline(
+		cmd.NewCmd("./test/count-and-sleep", "3", "5"),
+		cmd.NewCmd("cat"),
+	)
+	statusChan := p.StartContext(ctx)
+
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+
+	var gotStatus cmd.PipelineStatus
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	for i, stage := range gotStatus.Stages {
+		if !stage.Cancelled || stage.Reason != cmd.ReasonContextCancelled {
+			t.Errorf("stage %d: got cancelled %v, reason %v, expected cancelled", i, stage.Cancelled, stage.Reason)
+		}
+	}
+
+	if !errors.Is(gotStatus.Err(), context.Canceled) {
+		t.Errorf("got err %v, expected errors.Is context.Canceled", gotStatus.Err())
+	}
+
+	// If ctx is already done, no command is started
+	p = cmd.NewPipeline(cmd.NewCmd("echo", "a"), cmd.NewCmd("cat"))
+	gotStatus = <-p.StartContext(ctx)
+
+	for i, stage := range gotStatus.Stages {
+		if stage.PID != 0 || stage.Reason != cmd.ReasonContextCancelled {
+			t.Errorf("stage %d: got PID %d, reason %v, expected not started", i, stage.PID, stage.Reason)
+		}
+	}
+}
+
+func TestPipelineProcesses(t *testing.T) {
+	// The orphan of the second command is in the process group of the first one
+	first := cmd.NewCmd("sleep", "5")
+	second := cmd.NewCmd("bash", "-c", "(sleep 6 &); cat; true")
+	p := cmd.NewPipeline(first, second)
+	statusChan := p.Start()
+
+	time.Sleep(300 * time.Millisecond)
+
+	procs, err := second.Processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotCmdlines [][]string
+	for _, proc := range procs {
+		gotCmdlines = append(gotCmdlines, proc.Cmdline)
+	}
+
+	expectCmdlines := [][]string{
+		{"bash", "-c", "(sleep 6 &); cat; true"},
+		{"cat"},
+		{"sleep", "6"},
+	}
+	if diffs := deep.Equal(gotCmdlines, expectCmdlines); diffs != nil {
+		t.Error(diffs)
+	}
+
+	_ = p.Stop()
+	<-statusChan
+}
+
+func TestPipelineStop(t *testing.T) {
+	p := cmd.NewPipeline(
+		cmd.NewCmd("./test/count-and-sleep", "3", "5"),
+		cmd.NewCmd("cat"),
+	)
+	statusChan := p.Start()
+
+	time.Sleep(500 * time.Millisecond)
+
+	// All commands run in the process group of the first one
+	status := p.Status()
+	for _, stage := range status.Stages {
+		pgid, err := syscall.Getpgid(stage.PID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pgid != status.Stages[0].PID {
+			t.Errorf("got pgid %d, expected %d", pgid, status.Stages[0].PID)
+		}
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.PipelineStatus
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	for i, stage := range gotStatus.Stages {
+		if stage.Reason != cmd.ReasonStopped || stage.Signal != syscall.SIGTERM {
+			t.Errorf("stage %d: got reason %v, signal %v, expected stopped by SIGTERM", i, stage.Reason, stage.Signal)
+		}
+	}
+
+	if gotStatus.Complete {
+		t.Error("got Complete = true, expected false")
+	}
+
+	if expect := 128 + int(syscall.SIGTERM); gotStatus.Exit != expect {
+		t.Errorf("got Exit %d, expected %d", gotStatus.Exit, expect)
+	}
+
+	if diffs := deep.Equal(gotStatus.Stages[1].Stdout, []string{"1"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Error(err)
+	}
+}
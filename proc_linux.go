@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of times in /proc/<pid>/stat. It is 100 on
+// all Linux platforms Go supports.
+const clockTicks = 100
+
+// procStat represents the fields of /proc/<pid>/stat used by this package.
+// See proc(5).
+type procStat struct {
+	PID              int
+	Comm             string
+	State            string
+	PPID             int
+	PGID             int
+	MinorFaults      int64
+	ChildMinorFaults int64
+	MajorFaults      int64
+	ChildMajorFaults int64
+	UserTime         time.Duration
+	SystemTime       time.Duration
+	ChildUserTime    time.Duration
+	ChildSystemTime  time.Duration
+	RSS              int64 // bytes
+}
+
+func readProcStat(pid int) (procStat, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	return parseProcStat(data)
+}
+
+func parseProcStat(data []byte) (procStat, error) {
+	// "pid (comm) state ppid ...": comm can contain spaces and parentheses,
+	// so it ends at the last ')'.
+	open := bytes.IndexByte(data, '(')
+	closing := bytes.LastIndexByte(data, ')')
+
+	if open < 0 || closing < open {
+		return procStat{}, fmt.Errorf("malformed stat: %q", data)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data[:open])))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	// Fields after comm, starting with field 3 (state) at index 0
+	f := strings.Fields(string(data[closing+1:]))
+	if len(f) < 22 {
+		return procStat{}, fmt.Errorf("malformed stat: %q", data)
+	}
+
+	n := func(i int) int64 { v, _ := strconv.ParseInt(f[i], 10, 64); return v }
+	ticks := func(i int) time.Duration { return time.Duration(n(i)) * time.Second / clockTicks }
+
+	return procStat{
+		PID:              pid,
+		Comm:             string(data[open+1 : closing]),
+		State:            f[0],
+		PPID:             int(n(1)),
+		PGID:             int(n(2)),
+		MinorFaults:      n(7),
+		ChildMinorFaults: n(8),
+		MajorFaults:      n(9),
+		ChildMajorFaults: n(10),
+		UserTime:         ticks(11),
+		SystemTime:       ticks(12),
+		ChildUserTime:    ticks(13),
+		ChildSystemTime:  ticks(14),
+		RSS:              n(21) * int64(os.Getpagesize()),
+	}, nil
+}
+
+// readProcKeyValues reads the numeric "key: value [kB]" lines of
+// /proc/<pid>/<name>, like status or io.
+func readProcKeyValues(pid int, name string) (map[string]int64, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/%s", pid, name))
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]int64{}
+	s := bufio.NewScanner(bytes.NewReader(data))
+
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		f := strings.Fields(kv[1])
+		if len(f) == 0 {
+			continue
+		}
+
+		if v, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+			values[kv[0]] = v
+		}
+	}
+
+	return values, nil
+}
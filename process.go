@@ -0,0 +1,44 @@
+package cmd
+
+import "time"
+
+// Process represents a process in the tree of a running command. See
+// Cmd.Processes.
+type Process struct {
+	PID     int
+	PPID    int
+	PGID    int
+	Depth   int           // 0 for the command process, 1 for its children, etc.
+	Cmdline []string      // command line, "[comm]" if not available, like for zombies
+	State   string        // process state like R (running), S (sleeping) or Z (zombie); see proc(5)
+	RSS     int64         // resident set size, in bytes
+	CPU     time.Duration // user and system CPU time
+}
+
+// Processes returns the command process and all its descendants, in tree order:
+// every process is followed by its children with Depth + 1. Processes in the
+// command's process group that are no longer descendants, because their parent
+// exited, are appended with Depth 0. It returns ErrNotStarted if the command has
+// not been started, ErrDone if it has finished and ErrNotSupported on platforms
+// other than Linux.
+//
+// The tree is a snapshot read from /proc; processes can start and exit while
+// it is being read.
+func (c *Cmd) Processes() ([]Process, error) {
+	c.Lock()
+
+	if c.statusChan == nil || !c.started {
+		c.Unlock()
+		return nil, ErrNotStarted
+	}
+
+	if c.done {
+		c.Unlock()
+		return nil, ErrDone
+	}
+
+	pid, pgid := c.status.PID, c.groupID()
+	c.Unlock()
+
+	return listProcesses(pid, pgid)
+}
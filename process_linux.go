@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+func listProcesses(pid, pgid int) ([]Process, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[int]procStat{}
+	children := map[int][]int{}
+
+	for _, entry := range entries {
+		p, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // not a process
+		}
+
+		stat, err := readProcStat(p)
+		if err != nil {
+			continue // process exited
+		}
+
+		stats[p] = stat
+		children[stat.PPID] = append(children[stat.PPID], p)
+	}
+
+	if _, ok := stats[pid]; !ok {
+		return nil, ErrDone
+	}
+
+	var procs []Process
+
+	visited := map[int]bool{}
+
+	var walk func(p, depth int)
+	walk = func(p, depth int) {
+		visited[p] = true
+		procs = append(procs, newProcess(stats[p], depth))
+
+		kids := children[p]
+		sort.Ints(kids)
+
+		for _, kid := range kids {
+			if !visited[kid] {
+				walk(kid, depth+1)
+			}
+		}
+	}
+
+	walk(pid, 0)
+
+	// Orphans still in the process group, like background jobs of a shell script
+	// that already exited, are reparented to init (or a subreaper). The other
+	// commands of a Pipeline share the process group, but are children of this
+	// process.
+	var orphans []int
+
+	self := os.Getpid()
+
+	for p, stat := range stats {
+		if stat.PGID != pgid || visited[p] || stat.PPID == self {
+			continue
+		}
+
+		if parent, ok := stats[stat.PPID]; !ok || parent.PGID != pgid {
+			orphans = append(orphans, p) // else, walked as child of its parent
+		}
+	}
+
+	sort.Ints(orphans)
+
+	for _, p := range orphans {
+		if !visited[p] {
+			walk(p, 0)
+		}
+	}
+
+	return procs, nil
+}
+
+func newProcess(stat procStat, depth int) Process {
+	return Process{
+		PID:     stat.PID,
+		PPID:    stat.PPID,
+		PGID:    stat.PGID,
+		Depth:   depth,
+		Cmdline: readProcCmdline(stat.PID, stat.Comm),
+		State:   stat.State,
+		RSS:     stat.RSS,
+		CPU:     stat.UserTime + stat.SystemTime,
+	}
+}
+
+func readProcCmdline(pid int, comm string) []string {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	data = bytes.TrimRight(data, "\x00")
+
+	if err != nil || len(data) == 0 {
+		return []string{"[" + comm + "]"}
+	}
+
+	var args []string
+	for _, arg := range bytes.Split(data, []byte{0}) {
+		args = append(args, string(arg))
+	}
+
+	return args
+}
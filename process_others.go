@@ -0,0 +1,5 @@
+// +build !linux
+
+package cmd
+
+func listProcesses(pid, pgid int) ([]Process, error) { return nil, ErrNotSupported }
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"sync"
+)
+
+// ProgressMode determines how output lines repainted with "\r", like progress
+// bars of curl, rsync --progress or docker pull, are handled. See
+// Options.Progress.
+type ProgressMode int
+
+const (
+	// ProgressNone does not handle repaints: a line is only terminated by "\n",
+	// so all repaints accumulate into one line until then.
+	ProgressNone ProgressMode = iota
+	// ProgressEvents makes each repaint a line of output, like ScanCRLines.
+	ProgressEvents
+	// ProgressLatest only keeps the latest repaint of a line, like a terminal
+	// shows it: "10%\r50%\r100%\n" is one line, "100%". Repaints do not
+	// accumulate in the line buffer.
+	ProgressLatest
+)
+
+// Progress returns the text of the latest repaint of a line, as written by the
+// command to STDOUT or STDERR, if Options.Progress is set. Else, or if no line
+// was repainted yet, it returns an empty string. It is safe to call while the
+// command is running and after it has finished.
+//
+// Both tools that end each repaint with "\r" ("10%\r20%\r") and tools that
+// begin each repaint with "\r" ("\r10%\r20%") are supported. Lines without
+// "\r" do not change the progress text.
+func (c *Cmd) Progress() string { return c.progress.get() }
+
+// scanLatestLines is a bufio.SplitFunc like ScanCRLines for ProgressLatest: it
+// splits lines on "\n", but only returns the text after the last "\r" of a
+// line and drops repaints before it as soon as they are written.
+func scanLatestLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, latestRepaint(data[0:i]), nil
+	}
+
+	if atEOF {
+		return len(data), latestRepaint(data), nil
+	}
+
+	// Drop repaints before the last "\r". The "\r" itself is kept, as it may be
+	// followed by "\n" in the next write.
+	if i := bytes.LastIndexByte(data, '\r'); i > 0 {
+		return i, nil, nil
+	}
+
+	return 0, nil, nil // request more data
+}
+
+// latestRepaint returns the text after the last "\r" of line, ignoring "\r" at
+// its end.
+func latestRepaint(line []byte) []byte {
+	line = bytes.TrimRight(line, "\r")
+
+	return line[bytes.LastIndexByte(line, '\r')+1:]
+}
+
+// progressTracker keeps the latest repaint written to its writers.
+type progressTracker struct {
+	*sync.Mutex
+	latest string
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{Mutex: &sync.Mutex{}}
+}
+
+func (t *progressTracker) get() string {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.latest
+}
+
+func (t *progressTracker) set(text []byte) {
+	t.Lock()
+	t.latest = string(text)
+	t.Unlock()
+}
+
+// writer returns a writer that updates the latest repaint. Each stream of output
+// needs its own writer.
+func (t *progressTracker) writer() *progressWriter {
+	return &progressWriter{tracker: t}
+}
+
+// progressWriter is the io.Writer of one stream of output tracked by a
+// progressTracker.
+type progressWriter struct {
+	tracker *progressTracker
+	seg     []byte // text since the last "\r" or "\n"
+	sawCR   bool   // the current line was repainted
+}
+
+// Write makes progressWriter implement the io.Writer interface.
+func (w *progressWriter) Write(p []byte) (n int, err error) {
+	for _, b := range p {
+		switch b {
+		case '\r':
+			if len(w.seg) > 0 {
+				w.tracker.set(w.seg) // repaint ended with "\r"
+			}
+
+			w.seg = w.seg[:0]
+			w.sawCR = true
+		case '\n':
+			if w.sawCR && len(w.seg) > 0 {
+				w.tracker.set(w.seg) // last repaint of the line
+			}
+
+			w.seg = w.seg[:0]
+			w.sawCR = false
+		default:
+			if len(w.seg) < DefaultLineBufferSize {
+				w.seg = append(w.seg, b)
+			}
+		}
+	}
+
+	// A repaint that began with "\r" is the latest until the next one
+	if w.sawCR && len(w.seg) > 0 {
+		w.tracker.set(w.seg)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,104 @@
+package cmd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func TestProgressEvents(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, Progress: cmd.ProgressEvents},
+		"bash", "-c", `echo start; printf '10%%\r50%%\r100%%\r\n' >&2; echo done`)
+	s := <-p.Start()
+
+	// Each repaint is a line
+	if diffs := deep.Equal(s.Stdout, []string{"start", "done"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if diffs := deep.Equal(s.Stderr, []string{"10%", "50%", "100%"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if got := p.Progress(); got != "100%" {
+		t.Errorf("got progress %q, expected \"100%%\"", got)
+	}
+}
+
+func TestProgressLatest(t *testing.T) {
+	// Each repaint waits for a line of input, so the test controls when it is
+	// written
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, StdinEnabled: true, Progress: cmd.ProgressLatest},
+		"bash", "-c", `echo start; for i in 1 2 3; do read; printf '\rstep %d' $i; done; read; echo; printf 'a\rb'`)
+	statusChan := p.Start()
+
+	// While running, the latest repaint that began with "\r" is the progress
+	for _, expect := range []string{"step 1", "step 2", "step 3"} {
+		p.Stdin <- ""
+
+		var got string
+
+		for i := 0; i < 100 && got != expect; i++ {
+			time.Sleep(10 * time.Millisecond)
+			got = p.Progress()
+		}
+
+		if got != expect {
+			t.Fatalf("got progress %q while running, expected %q", got, expect)
+		}
+	}
+
+	p.Stdin <- ""
+	s := <-statusChan
+
+	// Repaints of a line are collapsed to the latest
+	if diffs := deep.Equal(s.Stdout, []string{"start", "step 3", "b"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if got := p.Progress(); got != "b" {
+		t.Errorf("got progress %q, expected \"b\"", got)
+	}
+}
+
+func TestProgressLatestStreaming(t *testing.T) {
+	// Repaints longer than the line buffer together do not overflow it
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, CloseStreams: true, Progress: cmd.ProgressLatest},
+		"bash", "-c", `for i in $(seq 1 5000); do printf '\r%08d%064d' $i 0; done; echo`)
+	statusChan := p.Start()
+
+	var lines []string
+	for line := range p.Stdout {
+		lines = append(lines, line)
+	}
+
+	s := <-statusChan
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+
+	expect := "00005000" + "0000000000000000000000000000000000000000000000000000000000000000"
+	if diffs := deep.Equal(lines, []string{expect}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if got := p.Progress(); got != expect {
+		t.Errorf("got progress %q, expected %q", got, expect)
+	}
+}
+
+func TestProgressNone(t *testing.T) {
+	p := cmd.NewCmd("bash", "-c", `printf '10%%\r100%%\n'`)
+	s := <-p.Start()
+
+	// Without Options.Progress, repaints are part of the line
+	if diffs := deep.Equal(s.Stdout, []string{"10%\r100%"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if got := p.Progress(); got != "" {
+		t.Errorf("got progress %q, expected none", got)
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// WindowSize represents the size of a pseudo-terminal, in characters.
+type WindowSize struct {
+	Rows uint16
+	Cols uint16
+}
+
+// DefaultWindowSize is the pseudo-terminal size when Options.PTY is true and
+// Options.WindowSize is zero.
+var DefaultWindowSize = WindowSize{Rows: 24, Cols: 80}
+
+// PTYDrainTimeout bounds reading the pseudo-terminal after the command exits.
+// Reading ends when all processes have closed the terminal or, if another
+// process keeps it open (like a background child: "sleep 100 &"), when nothing
+// was written to it for PTYDrainTimeout. Later output of that process is lost.
+var PTYDrainTimeout = 100 * time.Millisecond
+
+// Resize sets the window size of the command's pseudo-terminal, which sends
+// the command a SIGWINCH signal. It returns ErrNoPTY if the command does not run
+// in a pseudo-terminal (see Options.PTY), ErrNotStarted if it has not been
+// started and ErrDone if it has finished.
+func (c *Cmd) Resize(rows, cols uint16) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.pty {
+		return ErrNoPTY
+	}
+
+	if c.statusChan == nil || !c.started {
+		return ErrNotStarted
+	}
+
+	if c.done {
+		return ErrDone
+	}
+
+	return setWindowSize(c.ptmx, WindowSize{Rows: rows, Cols: cols})
+}
+
+// preparePTY opens a pseudo-terminal and makes it the controlling terminal
+// and STDIN, STDOUT and STDERR of cmd. Output written to the terminal is
+// copied to the STDOUT writer set by prepareStdoutStderr.
+func (c *Cmd) preparePTY(cmd *exec.Cmd) error {
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		return err
+	}
+
+	ws := c.windowSize
+	if ws == (WindowSize{}) {
+		ws = DefaultWindowSize
+	}
+
+	if err := setWindowSize(ptmx, ws); err != nil {
+		_ = ptmx.Close()
+		_ = tty.Close()
+
+		return err
+	}
+
+	c.ptyOut = cmd.Stdout
+	if c.ptyOut == nil {
+		c.ptyOut = ioutil.Discard
+	}
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	setControllingTTY(cmd)
+
+	c.ptmx = ptmx
+	c.tty = tty
+
+	return nil
+}
+
+// startPTY closes our copy of the terminal, so reading the pseudo-terminal
+// master ends when the command (and its children) close theirs, and starts
+// copying output. If the command failed to start, it only closes both ends.
+func (c *Cmd) startPTY(started bool) {
+	if !c.pty {
+		return
+	}
+
+	_ = c.tty.Close()
+
+	if !started {
+		_ = c.ptmx.Close()
+		return
+	}
+
+	c.ptyDone = make(chan struct{})
+	c.ptyExited = make(chan struct{})
+
+	go func() {
+		defer close(c.ptyDone)
+
+		c.copyPTY()
+	}()
+}
+
+// copyPTY copies output from the pseudo-terminal master until all terminal fds
+// are closed (reading returns EIO) or, once the command has exited, nothing is
+// read for PTYDrainTimeout.
+func (c *Cmd) copyPTY() {
+	buf := make([]byte, 32*1024)
+
+	for {
+		select {
+		case <-c.ptyExited:
+			// Set before each read, so time spent writing the output, like to
+			// an unread streaming channel, does not count.
+			_ = c.ptmx.SetReadDeadline(time.Now().Add(PTYDrainTimeout))
+		default:
+		}
+
+		n, err := c.ptmx.Read(buf)
+		if n > 0 {
+			if _, werr := c.ptyOut.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// waitPTY waits for all output to be copied, then closes the pseudo-terminal.
+// It must be called after the command exits. See PTYDrainTimeout.
+func (c *Cmd) waitPTY() {
+	if !c.pty {
+		return
+	}
+
+	close(c.ptyExited)
+	_ = c.ptmx.SetReadDeadline(time.Now().Add(PTYDrainTimeout))
+
+	<-c.ptyDone
+
+	c.Lock()
+	defer c.Unlock()
+
+	_ = c.ptmx.Close()
+}
+
+// ptyStdin writes STDIN to the pseudo-terminal master. Closing it does not
+// close the master because that would hang up the terminal; it sends the
+// terminal EOF character instead.
+type ptyStdin struct{ *os.File }
+
+func (p ptyStdin) Close() error {
+	_, err := p.Write([]byte{ptyEOF})
+	return err
+}
+
+// ptyEOF is VEOF, the default terminal EOF character (Ctrl-D).
+const ptyEOF = 0x04
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+func openPTY() (ptmx, tty *os.File, err error) {
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Calling os.File.Fd would put the file in blocking mode, so do the ioctls on
+	// the raw fd, then make the file non-blocking to use the runtime poller. Else,
+	// closing the master would not interrupt a blocked read.
+	var unlock int32
+
+	var n uint32
+
+	if err = ioctl(uintptr(fd), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err == nil {
+		err = ioctl(uintptr(fd), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n)))
+	}
+
+	if err == nil {
+		err = syscall.SetNonblock(fd, true)
+	}
+
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, nil, err
+	}
+
+	ptmx = os.NewFile(uintptr(fd), "/dev/ptmx")
+
+	tty, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = ptmx.Close()
+		return nil, nil, err
+	}
+
+	return ptmx, tty, nil
+}
+
+func setWindowSize(ptmx *os.File, ws WindowSize) error {
+	conn, err := ptmx.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	winsize := struct{ Row, Col, Xpixel, Ypixel uint16 }{Row: ws.Rows, Col: ws.Cols}
+
+	var ioctlErr error
+
+	if err := conn.Control(func(fd uintptr) {
+		ioctlErr = ioctl(fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&winsize)))
+	}); err != nil {
+		return err
+	}
+
+	return ioctlErr
+}
+
+func setControllingTTY(cmd *exec.Cmd) {
+	// A new session also makes the command the leader of a new process group,
+	// like SetGroupID, so Stop still signals the command and all its children.
+	// Ctty is the child's fd of the terminal, which is STDIN.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
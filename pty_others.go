@@ -0,0 +1,14 @@
+// +build !linux
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+func openPTY() (ptmx, tty *os.File, err error) { return nil, nil, ErrNotSupported }
+
+func setWindowSize(ptmx *os.File, ws WindowSize) error { return ErrNotSupported }
+
+func setControllingTTY(cmd *exec.Cmd) {}
@@ -0,0 +1,157 @@
+// +build linux
+
+package cmd_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func TestPTY(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, PTY: true},
+		"bash", "-c", "test -t 0 && test -t 1 && test -t 2 && echo tty; stty size; echo err >&2")
+	gotStatus := <-p.Start()
+
+	if gotStatus.Error != nil {
+		t.Fatal(gotStatus.Error)
+	}
+
+	// STDERR is merged into STDOUT because a terminal has only one output
+	expectStdout := []string{"tty", "24 80", "err"}
+	if diffs := deep.Equal(gotStatus.Stdout, expectStdout); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if len(gotStatus.Stderr) != 0 {
+		t.Errorf("got stderr %v, expected none", gotStatus.Stderr)
+	}
+}
+
+func TestPTYResize(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, PTY: true, WindowSize: cmd.WindowSize{Rows: 10, Cols: 20}},
+		"bash", "-c", "stty size; sleep 0.5; stty size")
+
+	if err := p.Resize(40, 100); err != cmd.ErrNotStarted {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrNotStarted)
+	}
+
+	statusChan := p.Start()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if err := p.Resize(40, 100); err != nil {
+		t.Error(err)
+	}
+
+	gotStatus := <-statusChan
+	if diffs := deep.Equal(gotStatus.Stdout, []string{"10 20", "40 100"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if err := p.Resize(40, 100); err != cmd.ErrDone {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrDone)
+	}
+
+	if err := cmd.NewCmd("true").Resize(40, 100); err != cmd.ErrNoPTY {
+		t.Errorf("got err %v, expected %v", err, cmd.ErrNoPTY)
+	}
+}
+
+func TestPTYStdinStream(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Streaming: true, PTY: true},
+		"bash", "-c", "read name; echo hello $name")
+	statusChan := p.Start()
+
+	p.Stdin <- "bob"
+
+	// Input is echoed by the terminal
+	for _, expectLine := range []string{"bob", "hello bob"} {
+		select {
+		case line := <-p.Stdout:
+			if line != expectLine {
+				t.Errorf("got line %q, expected %q", line, expectLine)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout reading streaming output")
+		}
+	}
+
+	if gotStatus := <-statusChan; gotStatus.Exit != 0 {
+		t.Errorf("got exit %d, expected 0", gotStatus.Exit)
+	}
+}
+
+func TestPTYBackgroundChild(t *testing.T) {
+	// A background child ignoring SIGHUP keeps the terminal open after the
+	// command exits
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, PTY: true}, "bash", "-c", "(trap '' HUP; sleep 3) & echo hi")
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-p.Start():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if diffs := deep.Equal(gotStatus.Stdout, []string{"hi"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestPTYCloseStdin(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, PTY: true}, "wc", "-l")
+	statusChan := p.Start()
+
+	p.Stdin <- "foo"
+	p.Stdin <- "bar"
+
+	if err := p.CloseStdin(); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if !gotStatus.Complete || gotStatus.Exit != 0 {
+		t.Errorf("got Complete %v, Exit %d, expected true, 0", gotStatus.Complete, gotStatus.Exit)
+	}
+
+	// Input is echoed by the terminal before wc prints its count
+	if n := len(gotStatus.Stdout); n == 0 || gotStatus.Stdout[n-1] != "2" {
+		t.Errorf("got stdout %q, expected last line \"2\"", gotStatus.Stdout)
+	}
+}
+
+func TestPTYStop(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, PTY: true}, "./test/count-and-sleep", "3", "5")
+	statusChan := p.Start()
+
+	time.Sleep(500 * time.Millisecond)
+
+	if err := p.Stop(); err != nil {
+		t.Error(err)
+	}
+
+	var gotStatus cmd.Status
+	select {
+	case gotStatus = <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for statusChan")
+	}
+
+	if gotStatus.Signal != syscall.SIGTERM {
+		t.Errorf("got signal %v, expected %v", gotStatus.Signal, syscall.SIGTERM)
+	}
+
+	if diffs := deep.Equal(gotStatus.Stdout, []string{"1"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
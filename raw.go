@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// rawBuffer keeps the exact bytes of output for Status.StdoutBytes. Unlike
+// OutputBuffer, it does not split output into lines, so binary output is not
+// corrupted.
+type rawBuffer struct {
+	*sync.Mutex
+	buf bytes.Buffer
+}
+
+func newRawBuffer() *rawBuffer {
+	return &rawBuffer{Mutex: &sync.Mutex{}}
+}
+
+// Write makes rawBuffer implement the io.Writer interface.
+func (rb *rawBuffer) Write(p []byte) (n int, err error) {
+	rb.Lock()
+	defer rb.Unlock()
+
+	return rb.buf.Write(p)
+}
+
+// since returns a copy of the bytes written after the first offset bytes, and
+// the number of bytes written so far.
+func (rb *rawBuffer) since(offset int) ([]byte, int) {
+	rb.Lock()
+	defer rb.Unlock()
+
+	return bytesSince(rb.buf.Bytes(), offset)
+}
+
+// bytes returns the bytes written, without copying them. Call it only once
+// nothing more is written.
+func (rb *rawBuffer) bytes() []byte {
+	rb.Lock()
+	defer rb.Unlock()
+
+	b := rb.buf.Bytes()
+
+	return b[:len(b):len(b)]
+}
+
+func bytesSince(b []byte, offset int) ([]byte, int) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	if offset >= len(b) {
+		return nil, len(b)
+	}
+
+	return append([]byte{}, b[offset:]...), len(b)
+}
+
+// StdoutBytesSince returns a copy of the exact STDOUT bytes written after the
+// first offset bytes, and the offset to pass to the next call to get only newer
+// bytes, with Options.RawBuffered. Start with offset zero. Status.StdoutBytes
+// is only set when the command finishes, so call it to read the bytes while the
+// command is running. It is also safe to call after the command finishes. If
+// raw output is not buffered or the command has not been started, it returns no
+// bytes and offset.
+func (c *Cmd) StdoutBytesSince(offset int) ([]byte, int) {
+	c.Lock()
+
+	if c.statusChan == nil || !c.started || !c.rawBuffered {
+		c.Unlock()
+		return nil, offset
+	}
+
+	if c.final {
+		b := c.status.StdoutBytes
+		c.Unlock()
+
+		return bytesSince(b, offset)
+	}
+
+	rb := c.rawBuf
+	c.Unlock()
+
+	return rb.since(offset)
+}
+
+// rawOutput returns true if STDOUT is written as is; see Options.RawStdout.
+func (c *Cmd) rawOutput() bool { return c.rawStdout != nil || c.rawBuffered }
+
+// lineOutput writes to w, the line output, until it returns an error, after
+// which it drops the output. It never returns an error, so the other writers,
+// like those of raw output, still get all output.
+type lineOutput struct {
+	w   io.Writer
+	err error
+}
+
+// Write makes lineOutput implement the io.Writer interface.
+func (lo *lineOutput) Write(p []byte) (n int, err error) {
+	if lo.err == nil {
+		_, lo.err = lo.w.Write(p)
+	}
+
+	return len(p), nil
+}
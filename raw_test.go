@@ -0,0 +1,163 @@
+package cmd_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func TestRawStdout(t *testing.T) {
+	var raw bytes.Buffer
+
+	p := cmd.NewCmdOptions(cmd.Options{RawStdout: &raw, RawBuffered: true},
+		"bash", "-c", `printf 'a\r\nb\x00\xff\n\rc'; echo err >&2`)
+	s := <-p.Start()
+
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+
+	// Output is not split into lines, so the bytes are exact
+	expect := []byte("a\r\nb\x00\xff\n\rc")
+
+	if !bytes.Equal(raw.Bytes(), expect) {
+		t.Errorf("got RawStdout %q, expected %q", raw.Bytes(), expect)
+	}
+
+	if !bytes.Equal(s.StdoutBytes, expect) {
+		t.Errorf("got Status.StdoutBytes %q, expected %q", s.StdoutBytes, expect)
+	}
+
+	// Not Buffered
+	if s.Stdout != nil || s.Stderr != nil {
+		t.Errorf("got buffered output %q and %q, expected none", s.Stdout, s.Stderr)
+	}
+}
+
+func TestRawStdoutBinary(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, RawBuffered: true},
+		"bash", "-c", "seq 1 10000 | gzip -c")
+	s := <-p.Start()
+
+	if s.Error != nil {
+		t.Fatal(s.Error)
+	}
+
+	// Lines are still buffered alongside, but only the bytes are valid gzip
+	if len(s.Stdout) == 0 {
+		t.Error("got no buffered STDOUT lines")
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(s.StdoutBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expect bytes.Buffer
+	for i := 1; i <= 10000; i++ {
+		fmt.Fprintln(&expect, i)
+	}
+
+	if !bytes.Equal(got, expect.Bytes()) {
+		t.Errorf("got %d bytes after gunzip, expected %d", len(got), expect.Len())
+	}
+}
+
+func TestRawStdoutCombined(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{CombinedOutput: true, RawBuffered: true},
+		"bash", "-c", `printf 1; printf 2 >&2; printf 3`)
+	s := <-p.Start()
+
+	if diffs := deep.Equal(string(s.StdoutBytes), "123"); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestRawStdoutStreaming(t *testing.T) {
+	// Binary output without newlines, longer than the streaming line buffer
+	size := cmd.DefaultLineBufferSize*4 + 10
+
+	p := cmd.NewCmdOptions(cmd.Options{RawBuffered: true, Streaming: true, CloseStreams: true},
+		"head", "-c", strconv.Itoa(size), "/dev/zero")
+	statusChan := p.Start()
+
+	streamed := 0
+	for line := range p.Stdout {
+		streamed += len(line)
+	}
+
+	for range p.Stderr {
+	}
+
+	s := <-statusChan
+	if s.Error != nil || s.Exit != 0 {
+		t.Fatalf("got error %v, exit %d, expected nil, 0", s.Error, s.Exit)
+	}
+
+	if len(s.StdoutBytes) != size {
+		t.Errorf("got %d raw bytes, expected %d", len(s.StdoutBytes), size)
+	}
+
+	// Overlong lines are split instead of stopping the output
+	if streamed != size {
+		t.Errorf("got %d streamed bytes, expected %d", streamed, size)
+	}
+}
+
+func TestStdoutBytesSince(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{RawBuffered: true, StdinEnabled: true},
+		"bash", "-c", `printf ab; read; printf 'c\0d'`)
+
+	if b, next := p.StdoutBytesSince(0); b != nil || next != 0 {
+		t.Errorf("got %q, %d before start, expected no bytes and 0", b, next)
+	}
+
+	statusChan := p.Start()
+
+	var got []byte
+
+	next := 0
+	for i := 0; i < 100 && len(got) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+
+		var b []byte
+		b, next = p.StdoutBytesSince(next)
+		got = append(got, b...)
+	}
+
+	// Status does not copy the bytes while the command is running
+	if s := p.Status(); s.StdoutBytes != nil {
+		t.Errorf("got Status.StdoutBytes %q while running, expected nil", s.StdoutBytes)
+	}
+
+	p.Stdin <- ""
+	s := <-statusChan
+
+	b, next := p.StdoutBytesSince(next)
+	got = append(got, b...)
+
+	if diffs := deep.Equal(string(got), "abc\x00d"); diffs != nil || next != 5 {
+		t.Errorf("got %q, %d, expected \"abc\\x00d\" and 5", got, next)
+	}
+
+	if diffs := deep.Equal(string(s.StdoutBytes), "abc\x00d"); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// The final bytes are kept for StdoutBytesSince
+	if b, next := p.StdoutBytesSince(3); string(b) != "\x00d" || next != 5 {
+		t.Errorf("got %q, %d after done, expected \"\\x00d\" and 5", b, next)
+	}
+}
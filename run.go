@@ -3,67 +3,170 @@ package cmd
 import (
 	"bytes"
 	"context"
-	"errors"
 	"io"
+	"os"
 	"os/exec"
 	"syscall"
 	"time"
 )
 
-func (c *Cmd) run(started chan bool) {
+func (c *Cmd) run(ctx context.Context, started chan bool) {
 	defer func() {
+		c.hub.close() // after the last lines, before the final status
+
+		if c.cancelLines != nil {
+			c.cancelLines()
+		}
+
+		if c.closeStreams && c.stdoutStream != nil {
+			_ = c.stdoutStream.Close()
+			_ = c.stderrStream.Close()
+		} else if c.closeStreams && c.Stdout != nil {
+			// Cancelled before the output was set up, so nothing was sent
+			close(c.Stdout)
+			close(c.Stderr)
+		}
+
 		c.statusChan <- c.Status() // unblocks Start if caller is waiting
 		close(c.doneChan)
 	}()
 
-	ctx := context.Background()
+	// Check the context before setting up the output, STDIN or pseudo-terminal,
+	// whose pipes and goroutines would leak if the command is not started.
+	if err := ctx.Err(); err != nil {
+		c.setStartFailedStatus(time.Now(), err, true)
+
+		started <- false
+
+		return
+	}
+
+	// The caller's context is not given to exec.CommandContext because that only
+	// kills the process, not its process group. See watchContext.
+	execCtx := context.Background()
 
 	if c.timeout > 0 {
 		// Create a new context and add a timeout to it
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		execCtx, cancel = context.WithTimeout(execCtx, c.timeout)
 
 		defer cancel() // The cancel should be deferred so resources are cleaned up
 	}
 	// Create the command with our context
-	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd := exec.CommandContext(execCtx, c.Name, c.Args...)
 
-	SetGroupID(cmd)
+	if c.pgid > 0 {
+		joinGroup(cmd, c.pgid)
+	} else {
+		SetGroupID(cmd)
+	}
 
-	c.processStdin(cmd)
 	c.prepareStdoutStderr(cmd)
 
+	now := time.Now()
+
+	if c.pty {
+		if err := c.preparePTY(cmd); err != nil {
+			c.setStartFailedStatus(now, &StartError{Name: c.Name, Err: err}, false)
+
+			started <- false
+
+			return
+		}
+	}
+
+	c.processStdin(cmd)
+
 	// Set the runtime environment for the command as per os/exec.Cmd.
 	// If Env is nil, use the current process' environment.
 	cmd.Env = c.Env
 	cmd.Dir = c.Dir
 
-	now := time.Now()
-
 	if err := cmd.Start(); err != nil {
-		c.Lock()
-		c.status.Error = err
-		c.status.StartTs = now.UnixNano()
-		c.status.StopTs = time.Now().UnixNano()
-		c.done = true
-		c.Unlock()
+		c.startPTY(false)
+		c.setStartFailedStatus(now, &StartError{Name: c.Name, Err: err}, false)
 
 		started <- false
 
 		return
 	}
 
+	c.startPTY(true)
 	c.setInitialStatus(now, cmd)
 
 	started <- true
 
+	if ctx.Done() != nil {
+		go c.watchContext(ctx)
+	}
+
+	// A Pipeline keeps the process from being reaped until all its commands
+	// have started, so the process group they join exists.
+	if c.waitGate != nil {
+		<-c.waitGate
+	}
+
 	// Wait for command to finish or be killed
 	err := cmd.Wait()
 	now = time.Now()
 
-	exitCode, signaled, err := c.dealErr(err)
+	c.waitPTY()
 
-	c.setFinalStatus(signaled, now, exitCode, err)
+	// All output is written, so the last lines are complete even without a
+	// newline.
+	if c.buffered {
+		c.stdout.Flush()
+		c.stderr.Flush()
+	}
+
+	if c.combined != nil {
+		c.combined.Flush()
+	}
+
+	if c.stdoutStream != nil {
+		c.stdoutStream.Flush()
+		c.stderrStream.Flush()
+	}
+
+	c.hubStdout.flush()
+	c.hubStderr.flush()
+
+	exitCode, sig, err := c.dealErr(err)
+
+	// The deadline can pass right after the command exits by itself, so the
+	// command only timed out if it was signaled (killed by exec.CommandContext).
+	c.Lock()
+	c.timedOut = sig != nil && execCtx.Err() == context.DeadlineExceeded
+	c.status.Rusage = rusageOf(cmd.ProcessState)
+	c.Unlock()
+
+	c.setFinalStatus(sig, now, exitCode, err)
+}
+
+// watchContext stops the command when ctx is done before the command ends.
+func (c *Cmd) watchContext(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		c.cancel(ctx.Err())
+	case <-c.doneChan:
+	}
+}
+
+func (c *Cmd) setStartFailedStatus(now time.Time, err error, cancelled bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.status.Error = err
+	c.status.Cancelled = cancelled
+	c.status.Reason = ReasonStartFailed
+
+	if cancelled {
+		c.status.Reason = ReasonContextCancelled
+	}
+
+	c.status.StartTs = now.UnixNano()
+	c.status.StopTs = time.Now().UnixNano()
+	c.done = true
 }
 
 func (c *Cmd) setInitialStatus(now time.Time, cmd *exec.Cmd) {
@@ -76,55 +179,200 @@ func (c *Cmd) setInitialStatus(now time.Time, cmd *exec.Cmd) {
 	c.started = true
 }
 
-func (c *Cmd) setFinalStatus(signaled bool, now time.Time, exitCode int, err error) {
+func (c *Cmd) setFinalStatus(sig os.Signal, now time.Time, exitCode int, err error) {
 	c.Lock()
 	defer c.Unlock()
 
-	if !c.stopped && !signaled {
+	if !c.stopped && sig == nil {
 		c.status.Complete = true
 	}
 
 	c.status.Runtime = now.Sub(c.startTime).Seconds()
 	c.status.StopTs = now.UnixNano()
 	c.status.Exit = exitCode
+	c.status.Signal = sig
 	c.status.Error = err
+	c.status.Reason = c.reason(sig)
 	c.done = true
+
+	if c.exitError && err == nil && exitCode > 0 {
+		c.status.Error = c.newExitError(exitCode)
+	}
+
+	if errt, ok := err.(*SignalError); ok {
+		switch c.status.Reason {
+		case ReasonContextCancelled:
+			errt.Err = c.cancelErr
+		case ReasonTimedOut:
+			errt.Err = ErrTimeout
+		case ReasonStopped:
+			errt.Err = ErrStopped
+		}
+	}
+}
+
+// newExitError returns an *ExitError with the tail of the buffered output. The
+// caller must hold the lock.
+func (c *Cmd) newExitError(code int) *ExitError {
+	var stderr, combined []string
+
+	if c.buffered {
+		stderr = c.stderr.Lines()
+	}
+
+	if c.combined != nil {
+		combined = c.combined.Lines()
+	}
+
+	return newExitError(code, stderr, combined)
+}
+
+// reason returns why the command ended. The caller must hold the lock.
+func (c *Cmd) reason(sig os.Signal) Reason {
+	switch {
+	case c.status.Cancelled:
+		return ReasonContextCancelled
+	case c.timedOut:
+		return ReasonTimedOut
+	case c.stopped:
+		return ReasonStopped
+	case sig != nil:
+		return ReasonSignaled
+	default:
+		return ReasonExited
+	}
 }
 
 func (c *Cmd) prepareStdoutStderr(cmd *exec.Cmd) {
 	// Write stdout and stderr to buffers that are safe to read while writing
 	// and don't cause a race condition.
 	if c.buffered {
-		c.stdout = NewOutputBuffer()
-		c.stderr = NewOutputBuffer()
+		c.stdout = NewBoundedOutputBuffer(c.outputLimits)
+		c.stderr = NewBoundedOutputBuffer(c.outputLimits)
+	}
+
+	if c.Stdout != nil {
+		c.stdoutStream = NewOutputStream(c.Stdout)
+		c.stderrStream = NewOutputStream(c.Stderr)
+
+		// Binary output has no newlines, so with raw output, overlong lines are
+		// split instead of stopping all output.
+		overflow := c.lineOverflow
+		if overflow == OverflowError && c.rawOutput() {
+			overflow = OverflowSplit
+		}
+
+		for _, stream := range []*OutputStream{c.stdoutStream, c.stderrStream} {
+			stream.SetPolicy(c.streamPolicy)
+			stream.SetOverflowPolicy(overflow)
+			stream.SetSplitFunc(c.split)
+
+			if c.maxLineBuf > 0 {
+				stream.SetMaxLineBufferSize(c.maxLineBuf)
+			}
+		}
+	}
+
+	stdoutBuf := c.stdout
+	if c.buffered && c.combinedOutput {
+		c.combined = NewBoundedOutputBuffer(c.outputLimits)
+		stdoutBuf = c.combined
+	}
+
+	if c.buffered && c.split != nil {
+		c.stdout.SetSplitFunc(c.split)
+		c.stderr.SetSplitFunc(c.split)
+
+		if c.combined != nil {
+			c.combined.SetSplitFunc(c.split)
+		}
 	}
 
 	switch {
 	case c.buffered && c.Stdout != nil:
 		// Buffered and streaming, create both and combine with io.MultiWriter
-		cmd.Stdout = io.MultiWriter(NewOutputStream(c.Stdout), c.stdout)
-		cmd.Stderr = io.MultiWriter(NewOutputStream(c.Stderr), c.stderr)
+		cmd.Stdout = io.MultiWriter(c.stdoutStream, stdoutBuf)
+		cmd.Stderr = io.MultiWriter(c.stderrStream, c.stderr)
 	case c.buffered: // Buffered only
-		cmd.Stdout = c.stdout
+		cmd.Stdout = stdoutBuf
 		cmd.Stderr = c.stderr
 	case c.Stdout != nil: // Streaming only
-		cmd.Stdout = NewOutputStream(c.Stdout)
-		cmd.Stderr = NewOutputStream(c.Stderr)
+		cmd.Stdout = c.stdoutStream
+		cmd.Stderr = c.stderrStream
 	default: // No output (effectively >/dev/null 2>&1)
 		cmd.Stdout = nil
 		cmd.Stderr = nil
 	}
+
+	if c.replay || c.buffered && c.streamLines {
+		c.hub.keepHistory(c.outputLimits)
+	}
+
+	c.hubStdout = c.hub.writer(StreamStdout, c.split)
+	c.hubStderr = c.hub.writer(StreamStderr, c.split)
+
+	// Errors of the line output, like of a split function, only stop it, not
+	// the raw output.
+	if c.rawOutput() && cmd.Stdout != nil {
+		cmd.Stdout = &lineOutput{w: cmd.Stdout}
+	}
+
+	stdoutWriters := []io.Writer{c.hubStdout}
+	stderrWriters := []io.Writer{c.hubStderr}
+
+	if c.rawStdout != nil {
+		stdoutWriters = append(stdoutWriters, c.rawStdout)
+	}
+
+	if c.rawBuf != nil {
+		stdoutWriters = append(stdoutWriters, c.rawBuf)
+	}
+
+	if c.progressMode != ProgressNone {
+		stdoutWriters = append(stdoutWriters, c.progress.writer())
+		stderrWriters = append(stderrWriters, c.progress.writer())
+	}
+
+	if c.combinedOutput {
+		// With the same writer for both, os/exec gives the command one pipe for
+		// both (like 2>&1), so the output is in the exact order it was written.
+		w := c.outputWriter(cmd.Stdout, stdoutWriters...)
+		cmd.Stdout, cmd.Stderr = w, w
+	} else {
+		cmd.Stdout = c.outputWriter(cmd.Stdout, stdoutWriters...)
+		cmd.Stderr = c.outputWriter(cmd.Stderr, stderrWriters...)
+	}
+
+	// The pipe to the next command of a Pipeline is given to the command as is.
+	if c.pipeStdout != nil {
+		cmd.Stdout = c.pipeStdout
+	}
+}
+
+// outputWriter returns a writer that writes to the taps, then to the internal
+// writers, like the output hub, then to w if not nil. Taps, like an Expecter,
+// get raw output first so they never wait on an unread streaming channel.
+func (c *Cmd) outputWriter(w io.Writer, internal ...io.Writer) io.Writer {
+	writers := append([]io.Writer{}, c.outputTaps...)
+	writers = append(writers, internal...)
+
+	if w != nil {
+		writers = append(writers, w)
+	}
+
+	return io.MultiWriter(writers...)
 }
 
 // dealErr Get exit code of the command. According to the manual, Wait() returns:
 // "If the command fails to run or doesn't complete successfully, the error
 // is of type *ExitError. Other error types may be returned for I/O problems."
-func (c *Cmd) dealErr(err error) (int, bool, error) {
+func (c *Cmd) dealErr(err error) (int, os.Signal, error) {
 	exitCode := 0
-	signaled := false
+
+	var sig os.Signal
 
 	if err == nil {
-		return exitCode, signaled, err
+		return exitCode, sig, err
 	}
 
 	if errt, ok := err.(*exec.ExitError); ok {
@@ -142,28 +390,53 @@ func (c *Cmd) dealErr(err error) (int, bool, error) {
 			exitCode = waitStatus.ExitStatus() // -1 if signaled
 
 			if waitStatus.Signaled() {
-				signaled = true
-				err = errors.New(errt.Error()) // "signal: terminated"
+				sig = waitStatus.Signal()
+				err = &SignalError{Signal: sig} // "signal: terminated"
 			}
 		}
 	}
 
-	return exitCode, signaled, err
+	return exitCode, sig, err
 }
 
 func (c *Cmd) processStdin(cmd *exec.Cmd) {
+	switch {
+	case c.pipeStdin != nil:
+		cmd.Stdin = c.pipeStdin
+		return
+	case c.stdinReader != nil && c.pty:
+		go func() {
+			stdin := ptyStdin{c.ptmx}
+			if _, err := io.Copy(stdin, c.stdinReader); err == nil {
+				_ = stdin.Close()
+			}
+		}()
+		return
+	case c.stdinReader != nil:
+		cmd.Stdin = c.stdinReader
+		return
+	case c.stdin == nil:
+		return
+	case c.pty:
+		c.stdin.set(ptyStdin{c.ptmx}, nil)
+	default:
+		c.stdin.set(cmd.StdinPipe())
+	}
+
 	if c.Stdin == nil {
 		return
 	}
 
-	stdin, _ := cmd.StdinPipe()
+	// Drain the channel even after a write error so senders do not block. The
+	// error is returned by the next write to StdinWriter.
+	lines := c.Stdin
 
 	go func() {
-		for in := range c.Stdin {
+		for in := range lines {
 			buf := bytes.NewBufferString(in)
 			buf.WriteString("\n")
-			_, _ = stdin.Write(buf.Bytes())
+			_, _ = c.stdin.Write(buf.Bytes())
 		}
-		_ = stdin.Close()
+		_ = c.stdin.Close()
 	}()
 }
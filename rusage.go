@@ -0,0 +1,48 @@
+package cmd
+
+import "time"
+
+// Rusage represents the resource usage of a command. On Linux, Status.Rusage
+// is set from os.ProcessState.SysUsage when the command finishes, and
+// Cmd.SampleRusage reads it from /proc/<pid> while the command is running. Both
+// include the usage of children the command has waited for.
+type Rusage struct {
+	UserTime               time.Duration // user CPU time
+	SystemTime             time.Duration // system CPU time
+	MaxRSS                 int64         // maximum resident set size, in bytes
+	MinorFaults            int64         // page faults serviced without I/O
+	MajorFaults            int64         // page faults that required I/O
+	VoluntaryCtxSwitches   int64         // context switches because of waiting for a resource
+	InvoluntaryCtxSwitches int64         // context switches because of preemption
+	InBlock                int64         // block input operations (512-byte units)
+	OutBlock               int64         // block output operations (512-byte units)
+}
+
+// SampleRusage returns the current resource usage of the running command. After
+// the command finishes, it returns the final Status.Rusage. It returns
+// ErrNotStarted if the command has not been started and ErrNotSupported on
+// platforms other than Linux.
+func (c *Cmd) SampleRusage() (*Rusage, error) {
+	c.Lock()
+
+	if c.statusChan == nil || !c.started {
+		c.Unlock()
+		return nil, ErrNotStarted
+	}
+
+	if c.done {
+		usage := c.status.Rusage
+		c.Unlock()
+
+		if usage == nil {
+			return nil, ErrNotSupported
+		}
+
+		return usage, nil
+	}
+
+	pid := c.status.PID
+	c.Unlock()
+
+	return procRusage(pid)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func rusageOf(state *os.ProcessState) *Rusage {
+	if state == nil {
+		return nil
+	}
+
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return nil
+	}
+
+	return &Rusage{
+		UserTime:               time.Duration(ru.Utime.Nano()),
+		SystemTime:             time.Duration(ru.Stime.Nano()),
+		MaxRSS:                 ru.Maxrss * 1024, // kilobytes on Linux
+		MinorFaults:            ru.Minflt,
+		MajorFaults:            ru.Majflt,
+		VoluntaryCtxSwitches:   ru.Nvcsw,
+		InvoluntaryCtxSwitches: ru.Nivcsw,
+		InBlock:                ru.Inblock,
+		OutBlock:               ru.Oublock,
+	}
+}
+
+func procRusage(pid int) (*Rusage, error) {
+	stat, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Rusage{
+		UserTime:    stat.UserTime + stat.ChildUserTime,
+		SystemTime:  stat.SystemTime + stat.ChildSystemTime,
+		MinorFaults: stat.MinorFaults + stat.ChildMinorFaults,
+		MajorFaults: stat.MajorFaults + stat.ChildMajorFaults,
+	}
+
+	// The process can exit between reading stat and the other files, and io is
+	// only readable by the owner, so these are best effort.
+	if status, err := readProcKeyValues(pid, "status"); err == nil {
+		usage.MaxRSS = status["VmHWM"] * 1024 // "VmHWM:  1234 kB"
+		usage.VoluntaryCtxSwitches = status["voluntary_ctxt_switches"]
+		usage.InvoluntaryCtxSwitches = status["nonvoluntary_ctxt_switches"]
+	}
+
+	if io, err := readProcKeyValues(pid, "io"); err == nil {
+		usage.InBlock = io["read_bytes"] / 512
+		usage.OutBlock = io["write_bytes"] / 512
+	}
+
+	return usage, nil
+}
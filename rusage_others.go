@@ -0,0 +1,9 @@
+// +build !linux
+
+package cmd
+
+import "os"
+
+func rusageOf(state *os.ProcessState) *Rusage { return nil }
+
+func procRusage(pid int) (*Rusage, error) { return nil, ErrNotSupported }
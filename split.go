@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// ScanNUL is a bufio.SplitFunc that splits output into records terminated by a
+// NUL byte, like the output of find -print0. See Options.Split.
+func ScanNUL(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[0:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil // request more data
+}
+
+// ScanCRLines is a bufio.SplitFunc that splits output into lines terminated by
+// "\r", "\n" or "\r\n", so each repaint of a progress bar, like those of curl
+// or rsync --progress, is a line. See Options.Split.
+func ScanCRLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	i := bytes.IndexAny(data, "\r\n")
+
+	switch {
+	case i < 0 && atEOF:
+		return len(data), data, nil
+	case i < 0:
+		return 0, nil, nil // request more data
+	case data[i] == '\n':
+		return i + 1, data[0:i], nil
+	case i+1 < len(data) && data[i+1] == '\n':
+		return i + 2, data[0:i], nil // "\r\n"
+	case i+1 < len(data) || atEOF:
+		return i + 1, data[0:i], nil
+	default:
+		return 0, nil, nil // "\r" could be followed by "\n" in the next write
+	}
+}
+
+// ScanChunks is a bufio.SplitFunc that does not split output: each write by the
+// command is a token, as is. See Options.Split.
+func ScanChunks(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	return len(data), data, nil
+}
+
+// lineSplitter splits output into lines terminated by "\n" or "\r\n", or into
+// tokens by a bufio.SplitFunc. The last line is pending until its newline is
+// written or flush is called. It is not safe for multiple goroutines.
+//
+// If max is set, the pending line is bounded: bytes beyond max are dropped
+// until its newline is written, and the line is emitted followed by
+// LineTruncationMarker. With a split function, which is the only one to know
+// where a token ends, pending data longer than max is emitted that way at once.
+type lineSplitter struct {
+	partial []byte          // last line until its newline is written
+	fn      bufio.SplitFunc // if not nil, splits tokens instead of lines
+	err     error           // first error returned by fn
+
+	max       int  // if > 0, the maximum length of the pending line
+	cutting   bool // bytes of the pending line were dropped
+	truncated int  // lines truncated at max
+}
+
+// write calls emit for each line completed by p. It only returns an error
+// returned by the split function, after which nothing more is emitted.
+func (s *lineSplitter) write(p []byte, emit func(string)) error {
+	if s.fn != nil {
+		s.partial = append(s.partial, p...)
+
+		if err := s.scan(false, emit); err != nil {
+			return err
+		}
+
+		if s.max > 0 && len(s.partial) > s.max {
+			s.cutting = true
+			s.partial = s.partial[:s.max]
+			emit(s.line(nil))
+		}
+
+		return nil
+	}
+
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			break
+		}
+
+		emit(s.line(p[:i]))
+		p = p[i+1:]
+	}
+
+	s.add(p)
+
+	return nil
+}
+
+// add appends b to the pending line, dropping bytes beyond max.
+func (s *lineSplitter) add(b []byte) {
+	if s.max > 0 && len(s.partial)+len(b) > s.max {
+		b = b[:maxInt(s.max-len(s.partial), 0)]
+		s.cutting = true
+	}
+
+	s.partial = append(s.partial, b...)
+}
+
+// flush calls emit for the pending last line, if any.
+func (s *lineSplitter) flush(emit func(string)) {
+	if s.fn != nil {
+		_ = s.scan(true, emit)
+		return
+	}
+
+	if len(s.partial) > 0 {
+		emit(s.line(nil))
+	}
+}
+
+// scan calls emit for each token the split function returns, like
+// bufio.Scanner.Scan. Once the split function returns an error, nothing more is
+// emitted and the error is returned again, except for bufio.ErrFinalToken. A
+// token returned without advancing is an io.ErrNoProgress error, as it would be
+// returned again.
+func (s *lineSplitter) scan(atEOF bool, emit func(string)) error {
+	data := s.partial
+
+	for s.err == nil && len(data) > 0 {
+		advance, token, err := s.fn(data, atEOF)
+
+		switch {
+		case err != nil:
+			s.err = err
+
+			if err == bufio.ErrFinalToken && token != nil {
+				emit(string(token))
+			}
+
+			continue
+		case advance < 0:
+			s.err = bufio.ErrNegativeAdvance
+			continue
+		case advance > len(data):
+			s.err = bufio.ErrAdvanceTooFar
+			continue
+		case advance == 0 && token != nil:
+			// The same token would be returned again with more data
+			s.err = io.ErrNoProgress
+			continue
+		}
+
+		if token != nil {
+			emit(string(token))
+		}
+
+		if advance == 0 {
+			break // request more data
+		}
+
+		data = data[advance:]
+	}
+
+	if s.err != nil {
+		s.partial = s.partial[:0]
+
+		if s.err == bufio.ErrFinalToken {
+			return nil
+		}
+
+		return s.err
+	}
+
+	s.partial = s.partial[:copy(s.partial, data)]
+
+	return nil
+}
+
+// reset drops the pending last line.
+func (s *lineSplitter) reset() {
+	s.partial = s.partial[:0]
+	s.cutting = false
+}
+
+// line returns the pending partial line followed by b without a trailing "\r",
+// and LineTruncationMarker if it was truncated at max.
+func (s *lineSplitter) line(b []byte) string {
+	if len(s.partial) > 0 || s.max > 0 && len(b) > s.max {
+		s.add(b)
+		b = s.partial
+		s.partial = s.partial[:0]
+	}
+
+	if n := len(b); n > 0 && b[n-1] == '\r' && !s.cutting {
+		b = b[:n-1]
+	}
+
+	if !s.cutting {
+		return string(b)
+	}
+
+	s.cutting = false
+	s.truncated++
+
+	return string(b) + LineTruncationMarker
+}
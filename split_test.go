@@ -0,0 +1,192 @@
+package cmd_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func TestOutputBufferSplitFunc(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		split  bufio.SplitFunc
+		writes []string
+		expect []string
+	}{
+		{"nul", cmd.ScanNUL, []string{"a\x00b", "\x00c"}, []string{"a", "b", "c"}},
+		{"cr", cmd.ScanCRLines, []string{"10%\r20%\r", "\n30%\r\n100%\n"}, []string{"10%", "20%", "30%", "100%"}},
+		{"chunks", cmd.ScanChunks, []string{"a\nb", "c"}, []string{"a\nb", "c"}},
+		{"words", bufio.ScanWords, []string{"hello wo", "rld  foo"}, []string{"hello", "world", "foo"}},
+	} {
+		out := cmd.NewOutputBuffer()
+		out.SetSplitFunc(tc.split)
+
+		for _, w := range tc.writes {
+			if _, err := out.Write([]byte(w)); err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+		}
+
+		out.Flush()
+
+		if diffs := deep.Equal(out.Lines(), tc.expect); diffs != nil {
+			t.Error(tc.name, diffs)
+		}
+	}
+}
+
+func TestOutputBufferSplitFuncError(t *testing.T) {
+	errSplit := errors.New("bad frame")
+
+	out := cmd.NewOutputBuffer()
+	out.SetSplitFunc(func(data []byte, atEOF bool) (int, []byte, error) {
+		if data[0] != '+' {
+			return 0, nil, errSplit
+		}
+
+		return 2, data[1:2], nil
+	})
+
+	if _, err := out.Write([]byte("+a+b-c+d")); err != errSplit {
+		t.Errorf("got error %v, expected %v", err, errSplit)
+	}
+
+	// The error is returned again and nothing more is split
+	if _, err := out.Write([]byte("+e")); err != errSplit {
+		t.Errorf("got error %v, expected %v", err, errSplit)
+	}
+
+	if diffs := deep.Equal(out.Lines(), []string{"a", "b"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputBufferSplitFuncNoProgress(t *testing.T) {
+	// A token returned without advancing would be returned again, so it is an
+	// error instead of a duplicate line
+	out := cmd.NewOutputBuffer()
+	out.SetSplitFunc(func(data []byte, atEOF bool) (int, []byte, error) {
+		return 0, data, nil
+	})
+
+	if _, err := out.Write([]byte("a")); err != io.ErrNoProgress {
+		t.Errorf("got error %v, expected %v", err, io.ErrNoProgress)
+	}
+
+	if lines := out.Lines(); len(lines) != 0 {
+		t.Errorf("got lines %q, expected none", lines)
+	}
+}
+
+func TestOutputStreamSplitFunc(t *testing.T) {
+	lines := make(chan string, 10)
+	out := cmd.NewOutputStream(lines)
+	out.SetSplitFunc(cmd.ScanNUL)
+	out.SetLineBufferSize(4)
+
+	if _, err := out.Write([]byte("a\x00bc")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pending data is limited by the line buffer size. Only "d" of "def" is
+	// written, after "bc" pending.
+	n, err := out.Write([]byte("d\x00efghi"))
+	if _, ok := err.(cmd.ErrLineBufferOverflow); !ok {
+		t.Errorf("got error %v, expected cmd.ErrLineBufferOverflow", err)
+	}
+
+	if n != 2 {
+		t.Errorf("Write n = %d, expected 2", n)
+	}
+
+	_ = out.Close()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+
+	if diffs := deep.Equal(got, []string{"a", "bcd"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestOutputStreamSplitFuncOverflowPolicy(t *testing.T) {
+	// Data pending a token is limited like a line, see
+	// TestStreamingOverflowPolicy
+	for _, tc := range []struct {
+		policy cmd.OverflowPolicy
+		expect []string
+	}{
+		{cmd.OverflowSplit, []string{"abcd", "efgh", "ijlm", "nop", "k"}},
+		{cmd.OverflowTruncate, []string{"abcd" + cmd.LineTruncationMarker, "k"}},
+		{cmd.OverflowGrow, []string{"abcdefgh", "ijlmnop", "k"}}, // max 8
+	} {
+		lines := make(chan string, 10)
+		out := cmd.NewOutputStream(lines)
+		out.SetSplitFunc(cmd.ScanNUL)
+		out.SetLineBufferSize(4)
+		out.SetMaxLineBufferSize(8)
+		out.SetOverflowPolicy(tc.policy)
+
+		// The long token is written without its NUL, in writes longer than the
+		// line buffer
+		for _, p := range []string{"abcdefghij", "lmnop", "\x00k\x00"} {
+			n, err := out.Write([]byte(p))
+			if err != nil {
+				t.Fatalf("policy %d: got error %v", tc.policy, err)
+			}
+
+			if n != len(p) {
+				t.Errorf("policy %d: Write n = %d, expected %d", tc.policy, n, len(p))
+			}
+		}
+
+		_ = out.Close()
+
+		var got []string
+		for line := range lines {
+			got = append(got, line)
+		}
+
+		if diffs := deep.Equal(got, tc.expect); diffs != nil {
+			t.Error(tc.policy, diffs)
+		}
+	}
+}
+
+func TestCmdSplit(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, Split: cmd.ScanNUL}, "printf", "a b\\0c\\nd\\0")
+	s := <-p.Start()
+
+	if diffs := deep.Equal(s.Stdout, []string{"a b", "c\nd"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestCmdSplitSubscribe(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Split: cmd.ScanNUL},
+		"bash", "-c", `printf 'a\0b'; sleep 0.5; printf 'c\0d\0'`)
+	p.Start()
+
+	// Output is not split while no one subscribed. "bc" began before, so it is
+	// dropped.
+	time.Sleep(250 * time.Millisecond)
+
+	lines, cancel := p.Subscribe(cmd.SubscribeOptions{})
+	defer cancel()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line.Text)
+	}
+
+	if diffs := deep.Equal(got, []string{"d"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
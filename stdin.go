@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"io"
+	"sync"
+)
+
+// StdinWriter returns the STDIN of the command as an io.WriteCloser. Unlike the
+// Stdin channel, it writes bytes as is, without appending a newline, so it can
+// send binary data or partial lines, and it returns write errors, like a broken
+// pipe when the command has exited. Closing it sends EOF to the command. It
+// returns nil if STDIN is not enabled (see Options.StdinEnabled).
+//
+// Writes to the Stdin channel and the writer are serialized. The first write
+// error, from either, is returned by all subsequent writes. Write returns
+// ErrNotStarted if the command has not been started and ErrStdinClosed after
+// the writer has been closed.
+func (c *Cmd) StdinWriter() io.WriteCloser {
+	if c.stdin == nil {
+		return nil
+	}
+
+	return c.stdin
+}
+
+// CloseStdin closes STDIN of the command, which sends it EOF, without stopping
+// the command. Filters like sort, wc or jq need EOF to finish and write their
+// output, after which the command completes normally. Lines already sent on the
+// Stdin channel are written before STDIN is closed; the channel is closed too,
+// so sending more lines panics like sending on any closed channel. CloseStdin is
+// idempotent and a no-op if STDIN is not enabled. If called before Start, the
+// command starts with STDIN at EOF.
+//
+// With Options.PTY, the terminal stays open and EOF is sent as the terminal
+// EOF character (Ctrl-D), which only ends input at the start of a line.
+func (c *Cmd) CloseStdin() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.Stdin != nil {
+		// The goroutine writing the channel closes the writer after the last line.
+		SafeClose(c.Stdin)
+		return nil
+	}
+
+	if c.stdin != nil {
+		return c.stdin.Close()
+	}
+
+	return nil
+}
+
+// stdinWriter is the STDIN of a command shared by Cmd.Stdin and Cmd.StdinWriter.
+type stdinWriter struct {
+	mu  sync.Mutex // guards w and err
+	wmu sync.Mutex // serializes writes; Close does not wait for blocked writes
+	w   io.WriteCloser
+	err error // sticky write error, ErrStdinClosed after Close
+}
+
+// set sets the STDIN pipe of the started command.
+func (s *stdinWriter) set(w io.WriteCloser, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err != nil && s.err == nil:
+		s.err = err
+	case err == nil && s.err == ErrStdinClosed:
+		_ = w.Close() // closed before started
+	case err == nil:
+		s.w = w
+	}
+}
+
+func (s *stdinWriter) Write(p []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.Lock()
+	w, err := s.w, s.err
+	s.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if w == nil {
+		return 0, ErrNotStarted
+	}
+
+	n, err := w.Write(p)
+	if err != nil {
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+
+	return n, err
+}
+
+func (s *stdinWriter) Close() error {
+	s.mu.Lock()
+
+	if s.err == ErrStdinClosed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := s.w
+	s.err = ErrStdinClosed
+	s.mu.Unlock()
+
+	if w == nil {
+		return nil
+	}
+
+	return w.Close()
+}
@@ -1,15 +1,21 @@
 package cmd
 
-import "bytes"
+import (
+	"bufio"
+	"bytes"
+	"sync"
+	"unicode/utf8"
+)
 
 // OutputStream represents real time, line by line output from a running Cmd.
 // Lines are terminated by a single newline preceded by an optional carriage
 // return. Both newline and carriage return are stripped from the line when
 // sent to a caller-provided channel.
 //
-// The caller must begin receiving before starting the Cmd. Write blocks on the
-// channel; the caller must always read the channel. The channel is not closed
-// by the OutputStream.
+// The caller must begin receiving before starting the Cmd. By default, Write
+// blocks on the channel; the caller must always read the channel, else the
+// command is stalled writing output. Call SetPolicy to drop or queue lines
+// instead. The channel is not closed by the OutputStream.
 //
 // A Cmd in this package uses an OutputStream for both STDOUT and STDERR when
 // created by calling NewCmdOptions and Options.Streaming is true. To use
@@ -40,24 +46,86 @@ import "bytes"
 //
 // Since the channel is not closed by the OutputStream, the two indications that
 // all lines have been sent and received are the command finishing and the
-// channel size being zero.
+// channel size being zero. Else, call Close after the command finishes, then
+// the caller can simply range over the channel.
 type OutputStream struct {
 	streamChan chan string
 	bufSize    int
 	buf        []byte
 	lastChar   int
+
+	policy     StreamPolicy
+	overflow   OverflowPolicy
+	maxBufSize int           // for OverflowGrow
+	truncating bool          // drop output until the next newline or token; see OverflowTruncate
+	split      *lineSplitter // if not nil, splits tokens instead of lines; see SetSplitFunc
+
+	*sync.Mutex               // guards the fields below
+	dropped     int           // lines dropped by policy
+	spilled     []string      // lines queued by StreamSpill
+	drained     chan struct{} // closed when drain is done, nil if not running
+	closed      bool          // Close called
 }
 
+// StreamPolicy determines what happens to a line when a consumer is too slow
+// and its channel is full.
+type StreamPolicy int
+
+const (
+	// StreamBlock waits for the consumer to receive the line. It stalls the
+	// command writing output, and other consumers, until the consumer catches up.
+	StreamBlock StreamPolicy = iota
+	// StreamDropNewest drops the line that does not fit in the channel.
+	StreamDropNewest
+	// StreamDropOldest drops the oldest line in the channel to make room for
+	// the line. With an unbuffered channel, it is the same as StreamDropNewest.
+	StreamDropOldest
+	// StreamSpill queues the line in memory, without limit, until the consumer
+	// catches up. No line is dropped and the command is never stalled, at the
+	// cost of memory if the consumer never catches up.
+	StreamSpill
+)
+
+// OverflowPolicy determines what an OutputStream does when a line is longer than
+// its line buffer, that is when the line buffer is filled before a newline is
+// written to terminate the line.
+type OverflowPolicy int
+
+const (
+	// OverflowError makes Write return ErrLineBufferOverflow and a short write.
+	// With an os/exec.Cmd, this breaks the pipe, so the command gets no more
+	// output. It is the default.
+	OverflowError OverflowPolicy = iota
+	// OverflowSplit sends the line in chunks of the line buffer size. Chunks
+	// are not cut in the middle of a UTF-8 encoded rune, so they can be
+	// shorter.
+	OverflowSplit
+	// OverflowTruncate sends the beginning of the line, the size of the line
+	// buffer, followed by LineTruncationMarker, and drops the rest of the line.
+	// Like with OverflowSplit, the line is not cut in the middle of a rune.
+	OverflowTruncate
+	// OverflowGrow grows the line buffer up to a maximum size (see
+	// OutputStream.SetMaxLineBufferSize), then sends the line in chunks of the
+	// maximum size like OverflowSplit.
+	OverflowGrow
+)
+
+// LineTruncationMarker is appended to a line truncated by OverflowTruncate or
+// by a bounded OutputBuffer (see OutputLimits.MaxBytes).
+var LineTruncationMarker = " [...]"
+
 // NewOutputStream creates a new streaming output on the given channel. The
 // caller must begin receiving on the channel before the command is started.
-// The OutputStream never closes the channel.
+// The OutputStream only closes the channel when Close is called.
 func NewOutputStream(streamChan chan string) *OutputStream {
 	out := &OutputStream{
 		streamChan: streamChan,
 		// --
-		bufSize:  DefaultLineBufferSize,
-		buf:      make([]byte, DefaultLineBufferSize),
-		lastChar: 0,
+		bufSize:    DefaultLineBufferSize,
+		buf:        make([]byte, DefaultLineBufferSize),
+		lastChar:   0,
+		maxBufSize: DefaultMaxLineBufferSize,
+		Mutex:      &sync.Mutex{},
 	}
 
 	return out
@@ -66,6 +134,10 @@ func NewOutputStream(streamChan chan string) *OutputStream {
 // Write makes OutputStream implement the io.Writer interface. Do not call
 // this function directly.
 func (rw *OutputStream) Write(p []byte) (n int, err error) {
+	if rw.split != nil {
+		return rw.writeTokens(p)
+	}
+
 	n = len(p) // end of buffer
 	firstChar := 0
 
@@ -83,28 +155,66 @@ LINES:
 		// End of line offset is start (nextLine) + newline offset. Like bufio.Scanner,
 		// we allow \r\n but strip the \r too by decrementing the offset for that byte.
 		lastChar := firstChar + newlineOffset // "line\n"
-		if newlineOffset > 0 && p[newlineOffset-1] == '\r' {
+		if newlineOffset > 0 && p[lastChar-1] == '\r' {
 			lastChar-- // "line\r\n"
 		}
 
 		// Send the line, prepend line buffer if set
 		var line string
 		if rw.lastChar > 0 {
-			line = string(rw.buf[0:rw.lastChar])
+			bufChar := rw.lastChar
+			if newlineOffset == 0 && rw.buf[bufChar-1] == '\r' {
+				bufChar-- // "line\r" buffered, "\n" in this write
+			}
+
+			line = string(rw.buf[0:bufChar])
 			rw.lastChar = 0 // reset buffer
 		}
 		line += string(p[firstChar:lastChar])
-		rw.streamChan <- line // blocks if chan full
+
+		if rw.truncating {
+			rw.truncating = false // end of the line already sent truncated
+		} else {
+			rw.send(line)
+		}
 
 		// Next line offset is the first byte (+1) after the newline (i)
 		firstChar += newlineOffset + 1
 	}
 
-	if firstChar < n {
+	if rw.truncating {
+		return n, nil // rest of a truncated line, dropped
+	}
+
+	for firstChar < n {
 		remain := len(p[firstChar:])
 		bufFree := len(rw.buf[rw.lastChar:])
 
-		if remain > bufFree {
+		if remain <= bufFree {
+			copy(rw.buf[rw.lastChar:], p[firstChar:])
+			rw.lastChar += remain
+
+			break
+		}
+
+		switch rw.overflow {
+		case OverflowGrow:
+			if rw.grow(rw.lastChar + remain) {
+				continue
+			}
+
+			fallthrough // at max size
+		case OverflowSplit:
+			cut := runeCut(p, firstChar+bufFree, firstChar)
+			rw.sendFull(p[firstChar:cut], "")
+			firstChar = cut
+		case OverflowTruncate:
+			cut := runeCut(p, firstChar+bufFree, firstChar)
+			rw.sendFull(p[firstChar:cut], LineTruncationMarker)
+			rw.truncating = true
+
+			return n, nil
+		default:
 			var line string
 			if rw.lastChar > 0 {
 				line = string(rw.buf[0:rw.lastChar])
@@ -120,21 +230,317 @@ LINES:
 
 			return // implicit
 		}
-
-		copy(rw.buf[rw.lastChar:], p[firstChar:])
-		rw.lastChar += remain
 	}
 
 	return n, err // implicit
 }
 
+// writeTokens is Write with a split function. Like lines, tokens completed by
+// p are sent whole, and data pending a token is limited by the line buffer size
+// and handled by the overflow policy when it is longer.
+func (rw *OutputStream) writeTokens(p []byte) (n int, err error) {
+	if err := rw.split.write(p, rw.sendToken); err != nil {
+		return 0, err
+	}
+
+	for len(rw.split.partial) > rw.bufSize {
+		if rw.truncating {
+			rw.split.reset() // rest of a truncated token, dropped
+			break
+		}
+
+		partial := rw.split.partial
+
+		switch rw.overflow {
+		case OverflowGrow:
+			if rw.grow(len(partial)) {
+				continue
+			}
+
+			fallthrough // at max size
+		case OverflowSplit:
+			cut := runeCut(partial, rw.bufSize, 0)
+			rw.send(string(partial[:cut]))
+			rw.split.partial = partial[:copy(partial, partial[cut:])]
+		case OverflowTruncate:
+			cut := runeCut(partial, rw.bufSize, 0)
+			rw.send(string(partial[:cut]) + LineTruncationMarker)
+			rw.split.reset()
+			rw.truncating = true
+		default:
+			// Only the bytes of p still pending were not written
+			pending := len(partial)
+			if pending > len(p) {
+				pending = len(p)
+			}
+
+			rw.split.partial = partial[:len(partial)-pending]
+
+			return len(p) - pending, ErrLineBufferOverflow{
+				Line:       string(partial),
+				BufferSize: rw.bufSize,
+				BufferFree: rw.bufSize - len(rw.split.partial),
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// sendToken sends a token completed by the split function, unless it is the
+// rest of a token truncated by OverflowTruncate.
+func (rw *OutputStream) sendToken(token string) {
+	if rw.truncating {
+		rw.truncating = false
+		return
+	}
+
+	rw.send(token)
+}
+
+// runeCut returns i, or the start of the UTF-8 encoded rune that p[i] is in the
+// middle of if it begins after min, so p[:i] is not cut in the middle of a rune.
+func runeCut(p []byte, i, min int) int {
+	for j := i; j > min && i-j < utf8.UTFMax; j-- {
+		if utf8.RuneStart(p[j]) {
+			return j
+		}
+	}
+
+	return i
+}
+
+// sendFull sends the line buffer followed by p and suffix, and resets the line
+// buffer.
+func (rw *OutputStream) sendFull(p []byte, suffix string) {
+	line := string(rw.buf[0:rw.lastChar]) + string(p) + suffix
+	rw.lastChar = 0 // reset buffer
+	rw.send(line)
+}
+
+// grow grows the line buffer to hold at least size bytes, up to maxBufSize. It
+// returns false if the buffer is already at its maximum size.
+func (rw *OutputStream) grow(size int) bool {
+	if rw.bufSize >= rw.maxBufSize {
+		return false
+	}
+
+	newSize := rw.bufSize * 2
+	if newSize < size {
+		newSize = size
+	}
+
+	if newSize > rw.maxBufSize {
+		newSize = rw.maxBufSize
+	}
+
+	if rw.split == nil { // else, data pending a token is in the split buffer
+		buf := make([]byte, newSize)
+		copy(buf, rw.buf[0:rw.lastChar])
+		rw.buf = buf
+	}
+
+	rw.bufSize = newSize
+
+	return true
+}
+
 // Lines returns the channel to which lines are sent. This is the same channel
 // passed to NewOutputStream.
 func (rw *OutputStream) Lines() <-chan string { return rw.streamChan }
 
 // SetLineBufferSize sets the internal line buffer size. The default is DEFAULT_LINE_BUFFER_SIZE.
-// This function must be called immediately after NewOutputStream, and it is not
-// safe to call by multiple goroutines.
+// A size less than 1 is 1. This function must be called immediately after
+// NewOutputStream, and it is not safe to call by multiple goroutines.
 //
 // Increasing the line buffer size can help reduce ErrLineBufferOverflow errors.
-func (rw *OutputStream) SetLineBufferSize(n int) { rw.bufSize = n; rw.buf = make([]byte, rw.bufSize) }
+func (rw *OutputStream) SetLineBufferSize(n int) {
+	rw.bufSize = maxInt(n, 1)
+	rw.buf = make([]byte, rw.bufSize)
+}
+
+// SetOverflowPolicy sets what happens when a line is longer than the line
+// buffer. The default is OverflowError. This function must be called
+// immediately after NewOutputStream, and it is not safe to call by multiple
+// goroutines.
+func (rw *OutputStream) SetOverflowPolicy(policy OverflowPolicy) { rw.overflow = policy }
+
+// SetMaxLineBufferSize sets the maximum size the line buffer grows to with the
+// OverflowGrow policy. The default is DefaultMaxLineBufferSize. This function
+// must be called immediately after NewOutputStream, and it is not safe to call
+// by multiple goroutines.
+func (rw *OutputStream) SetMaxLineBufferSize(n int) { rw.maxBufSize = n }
+
+// SetSplitFunc sets a bufio.SplitFunc to split output into tokens instead of
+// lines, like ScanNUL for NUL-terminated records or ScanCRLines for progress
+// bars. Each token is then sent to the channel as a line. Data pending a token
+// is limited by the line buffer size like a line without its newline, so the
+// overflow policy applies to it (see SetOverflowPolicy). If the split function
+// returns an error, Write returns it. This function must be called
+// immediately after NewOutputStream, and it is not safe to call by multiple
+// goroutines.
+func (rw *OutputStream) SetSplitFunc(split bufio.SplitFunc) {
+	rw.split = nil
+	if split != nil {
+		rw.split = &lineSplitter{fn: split}
+	}
+}
+
+// SetPolicy sets what happens to lines when the channel is full. The default is
+// StreamBlock. This function must be called immediately after NewOutputStream,
+// and it is not safe to call by multiple goroutines.
+func (rw *OutputStream) SetPolicy(policy StreamPolicy) { rw.policy = policy }
+
+// Dropped returns the number of lines dropped because the channel was full.
+// It is always zero with the StreamBlock and StreamSpill policies.
+func (rw *OutputStream) Dropped() int {
+	rw.Lock()
+	defer rw.Unlock()
+
+	return rw.dropped
+}
+
+// send sends line to the channel according to the policy.
+func (rw *OutputStream) send(line string) {
+	switch rw.policy {
+	case StreamDropNewest:
+		select {
+		case rw.streamChan <- line:
+		default:
+			rw.drop()
+		}
+	case StreamDropOldest:
+		for {
+			select {
+			case rw.streamChan <- line:
+				return
+			default:
+			}
+
+			if cap(rw.streamChan) == 0 {
+				rw.drop()
+				return
+			}
+
+			select {
+			case <-rw.streamChan:
+				rw.drop()
+			default:
+			}
+		}
+	case StreamSpill:
+		rw.spill(line)
+	default:
+		rw.streamChan <- line // blocks if chan full
+	}
+}
+
+func (rw *OutputStream) drop() {
+	rw.Lock()
+	rw.dropped++
+	rw.Unlock()
+}
+
+// spill sends line to the channel if no lines are queued and the channel is not
+// full, else it queues the line to be sent by drain.
+func (rw *OutputStream) spill(line string) {
+	rw.Lock()
+	defer rw.Unlock()
+
+	if len(rw.spilled) == 0 {
+		select {
+		case rw.streamChan <- line:
+			return
+		default:
+		}
+	}
+
+	rw.spilled = append(rw.spilled, line)
+
+	if rw.drained == nil {
+		rw.drained = make(chan struct{})
+
+		go rw.drain()
+	}
+}
+
+// drain sends queued lines to the channel, in order, until none are left.
+func (rw *OutputStream) drain() {
+	for {
+		rw.Lock()
+		if len(rw.spilled) == 0 {
+			close(rw.drained)
+			rw.drained = nil
+			rw.Unlock()
+
+			return
+		}
+
+		line := rw.spilled[0]
+		rw.Unlock()
+
+		rw.streamChan <- line // blocks if chan full, but not Write
+
+		rw.Lock()
+		rw.spilled[0] = "" // release the line
+		rw.spilled = rw.spilled[1:]
+		rw.Unlock()
+	}
+}
+
+// Flush sends the pending last line, if any. Lines are sent when their newline
+// is written, so the last line is pending if the output ends without a newline.
+// Call Flush only after the command has finished, when nothing more is written,
+// like after os/exec.Cmd.Wait returns. A Cmd calls Flush on its streams when the
+// command ends. The line is not flagged as missing its newline; to know that,
+// use Cmd.Subscribe and check Line.Partial.
+func (rw *OutputStream) Flush() {
+	if rw.split != nil {
+		rw.split.flush(rw.sendToken)
+		return
+	}
+
+	if rw.lastChar == 0 {
+		return
+	}
+
+	end := rw.lastChar
+	if rw.buf[end-1] == '\r' {
+		end--
+	}
+
+	line := string(rw.buf[0:end])
+	rw.lastChar = 0 // reset buffer
+	rw.send(line)
+}
+
+// Close flushes the pending last line (see Flush) and closes the channel after
+// the lines queued by StreamSpill are sent, so the caller can range over the
+// channel. Call it only after the command has finished, when nothing more is
+// written. With StreamSpill, Close blocks until the caller receives the queued
+// lines. Close is idempotent and always returns nil.
+//
+// A Cmd calls Close on its streams when the command ends if
+// Options.CloseStreams is true.
+func (rw *OutputStream) Close() error {
+	rw.Flush()
+
+	rw.Lock()
+
+	if rw.closed {
+		rw.Unlock()
+		return nil
+	}
+
+	rw.closed = true
+	drained := rw.drained
+	rw.Unlock()
+
+	if drained != nil {
+		<-drained
+	}
+
+	close(rw.streamChan)
+
+	return nil
+}
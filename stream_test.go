@@ -1,6 +1,8 @@
 package cmd_test
 
 import (
+	"bufio"
+	"fmt"
 	"testing"
 
 	"github.com/go-test/deep"
@@ -178,6 +180,41 @@ LINES1:
 	}
 }
 
+func TestStreamingCarriageReturnAfterFirstLine(t *testing.T) {
+	// Carriage return should be stripped from every line, not only the first,
+	// even when "\r\n" is split across writes
+	lines := make(chan string, 5)
+	out := cmd.NewOutputStream(lines)
+
+	for _, input := range []string{"foo\r\nbar\r\nbaz\r", "\n"} {
+		n, err := out.Write([]byte(input))
+
+		if n != len(input) {
+			t.Errorf("Write n = %d, expected %d", n, len(input))
+		}
+
+		if err != nil {
+			t.Errorf("got err '%v', expected nil", err)
+		}
+	}
+
+	var gotLines []string
+
+LINES1:
+	for {
+		select {
+		case line := <-lines:
+			gotLines = append(gotLines, line)
+		default:
+			break LINES1
+		}
+	}
+
+	if diffs := deep.Equal(gotLines, []string{"foo", "bar", "baz"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
 func TestStreamingLineBuffering(t *testing.T) {
 	// Lines not terminated with newline are held in the line buffer until next
 	// write. When line is later terminated with newline, we prepend the buffered
@@ -429,3 +466,229 @@ func TestStreamingSetLineBufferSize(t *testing.T) {
 		t.Errorf("got line: '%s', expected '%s'", gotLine, expectLine)
 	}
 }
+
+func TestStreamingPolicyDrop(t *testing.T) {
+	for _, tc := range []struct {
+		policy cmd.StreamPolicy
+		expect []string
+	}{
+		{cmd.StreamDropNewest, []string{"1", "2"}},
+		{cmd.StreamDropOldest, []string{"3", "4"}},
+	} {
+		lines := make(chan string, 2)
+		out := cmd.NewOutputStream(lines)
+		out.SetPolicy(tc.policy)
+
+		// Nothing reads the channel, but Write doesn't block
+		if _, err := out.Write([]byte("1\n2\n3\n4\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := out.Dropped(); n != 2 {
+			t.Errorf("policy %d: got %d dropped lines, expected 2", tc.policy, n)
+		}
+
+		got := []string{<-lines, <-lines}
+		if diffs := deep.Equal(got, tc.expect); diffs != nil {
+			t.Error(tc.policy, diffs)
+		}
+	}
+}
+
+func TestStreamingPolicySpill(t *testing.T) {
+	lines := make(chan string, 1)
+	out := cmd.NewOutputStream(lines)
+	out.SetPolicy(cmd.StreamSpill)
+
+	// Nothing reads the channel, but Write doesn't block
+	if _, err := out.Write([]byte("1\n2\n3\n4\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// No line is dropped, and they're received in order
+	got := []string{<-lines, <-lines, <-lines, <-lines}
+	if diffs := deep.Equal(got, []string{"1", "2", "3", "4"}); diffs != nil {
+		t.Error(diffs)
+	}
+
+	if n := out.Dropped(); n != 0 {
+		t.Errorf("got %d dropped lines, expected 0", n)
+	}
+}
+
+func TestStreamingClose(t *testing.T) {
+	lines := make(chan string, 1)
+	out := cmd.NewOutputStream(lines)
+	out.SetPolicy(cmd.StreamSpill)
+
+	if _, err := out.Write([]byte("1\n2\n3\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Close waits for spilled lines to be received before closing the channel
+	done := make(chan struct{})
+
+	go func() {
+		_ = out.Close()
+		_ = out.Close() // idempotent
+		close(done)
+	}()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+
+	<-done
+
+	if diffs := deep.Equal(got, []string{"1", "2", "3"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestStreamingFlush(t *testing.T) {
+	lines := make(chan string, 5)
+	out := cmd.NewOutputStream(lines)
+
+	// Nothing to flush
+	out.Flush()
+
+	if _, err := out.Write([]byte("1\nlast\r")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-lines; got != "1" {
+		t.Errorf("got line %q, expected \"1\"", got)
+	}
+
+	out.Flush()
+
+	if _, err := out.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+
+	if diffs := deep.Equal(got, []string{"last"}); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestStreamingOverflowPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy cmd.OverflowPolicy
+		expect []string
+	}{
+		{cmd.OverflowSplit, []string{"abcd", "efgh", "ij", "k"}},
+		{cmd.OverflowTruncate, []string{"abcd" + cmd.LineTruncationMarker, "k"}},
+		{cmd.OverflowGrow, []string{"abcdefgh", "ij", "k"}}, // max 8
+	} {
+		lines := make(chan string, 10)
+		out := cmd.NewOutputStream(lines)
+		out.SetLineBufferSize(4)
+		out.SetMaxLineBufferSize(8)
+		out.SetOverflowPolicy(tc.policy)
+
+		// The long line is written without its newline first
+		for _, p := range []string{"abcdefghij", "\nk\n"} {
+			n, err := out.Write([]byte(p))
+			if err != nil {
+				t.Fatalf("policy %d: got error %v", tc.policy, err)
+			}
+
+			if n != len(p) {
+				t.Errorf("policy %d: Write n = %d, expected %d", tc.policy, n, len(p))
+			}
+		}
+
+		_ = out.Close()
+
+		var got []string
+		for line := range lines {
+			got = append(got, line)
+		}
+
+		if diffs := deep.Equal(got, tc.expect); diffs != nil {
+			t.Error(tc.policy, diffs)
+		}
+	}
+}
+
+func TestStreamingOverflowRunes(t *testing.T) {
+	for _, tc := range []struct {
+		policy cmd.OverflowPolicy
+		size   int
+		input  string
+		expect []string
+		split  bufio.SplitFunc
+	}{
+		// "é" is 2 bytes and "€" is 3 bytes, so 4 bytes would cut "€"
+		{cmd.OverflowSplit, 4, "aé€bcd", []string{"aé", "€b", "cd"}, nil},
+		{cmd.OverflowTruncate, 4, "aé€bcd", []string{"aé" + cmd.LineTruncationMarker}, nil},
+		// A size less than 1 is 1, else no chunk would ever be sent
+		{cmd.OverflowSplit, 0, "ab", []string{"a", "b"}, nil},
+		// Same with a split function
+		{cmd.OverflowSplit, 4, "aé€bcd", []string{"aé", "€b", "cd"}, bufio.ScanLines},
+		{cmd.OverflowTruncate, 4, "aé€bcd", []string{"aé" + cmd.LineTruncationMarker}, bufio.ScanLines},
+	} {
+		lines := make(chan string, 10)
+		out := cmd.NewOutputStream(lines)
+		out.SetLineBufferSize(tc.size)
+		out.SetOverflowPolicy(tc.policy)
+		out.SetSplitFunc(tc.split)
+
+		for _, p := range []string{tc.input, "\n"} {
+			if _, err := out.Write([]byte(p)); err != nil {
+				t.Fatalf("policy %d: got error %v", tc.policy, err)
+			}
+		}
+
+		_ = out.Close()
+
+		var got []string
+		for line := range lines {
+			got = append(got, line)
+		}
+
+		if diffs := deep.Equal(got, tc.expect); diffs != nil {
+			t.Error(tc.policy, tc.size, diffs)
+		}
+	}
+}
+
+func TestCmdStreamingLineOverflow(t *testing.T) {
+	long := 3*cmd.DefaultLineBufferSize + 1
+	p := cmd.NewCmdOptions(cmd.Options{
+		Streaming:    true,
+		CloseStreams: true,
+		LineOverflow: cmd.OverflowSplit,
+	}, "bash", "-c", fmt.Sprintf("head -c %d /dev/zero | tr '\\0' x; echo; echo end", long))
+	p.Start()
+
+	var got []string
+	for line := range p.Stdout {
+		got = append(got, line)
+	}
+
+	// How the long line is split depends on how it's read from the pipe, but
+	// it's split and streaming output is not stopped by the overflow
+	if len(got) < 3 || got[len(got)-1] != "end" {
+		t.Fatalf("got %d lines, expected the long line split and \"end\"", len(got))
+	}
+
+	n := 0
+	for _, line := range got[:len(got)-1] {
+		n += len(line)
+	}
+
+	if n != long {
+		t.Errorf("got %d bytes of the long line, expected %d", n, long)
+	}
+}
@@ -0,0 +1,410 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"sync"
+	"time"
+)
+
+// Stream identifies the output a Line was written to.
+type Stream int
+
+const (
+	// StreamStdout is STDOUT. With Options.PTY, it is all output.
+	StreamStdout Stream = iota + 1
+	// StreamStderr is STDERR.
+	StreamStderr
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamStdout:
+		return "stdout"
+	case StreamStderr:
+		return "stderr"
+	default:
+		return "unknown"
+	}
+}
+
+// Line is one line of output with where and when it was written. Lines are sent
+// to subscribers (see Cmd.Subscribe) and Cmd.Lines, and kept in Status.Lines.
+//
+// Seq orders lines of STDOUT and STDERR together by arrival, starting at zero.
+// Lines written while nothing gets them (no subscriber and output not buffered)
+// are not counted.
+type Line struct {
+	Text      string    // the line without "\n" or "\r\n"
+	Stream    Stream    // the output the line was written to
+	Timestamp time.Time // when the line was read from the command
+	Seq       int       // arrival order across STDOUT and STDERR
+	Partial   bool      // the last line of output, without newline
+}
+
+// SubscribeOptions represents customizations for Cmd.Subscribe.
+type SubscribeOptions struct {
+	// Buffer is the size of the channel. If zero, DefaultStreamChanSize is used.
+	Buffer int
+
+	// If Replay is true, lines written before Subscribe was called are sent
+	// first. Only lines kept by Options.Replay are replayed, bounded like the
+	// buffers by Options.OutputLimits except the limits count lines of STDOUT and
+	// STDERR together and no TruncationMarker line is sent for dropped lines.
+	Replay bool
+
+	// Policy determines what happens to lines when the channel is full.
+	// StreamSpill is not supported by subscribers; it is the same as StreamBlock.
+	Policy StreamPolicy
+}
+
+// Subscribe returns a new channel to which lines of STDOUT and STDERR are sent
+// as soon as they are written by the command, and a function to cancel the
+// subscription. Unlike the Stdout and Stderr channels, any number of consumers
+// can subscribe and each gets all lines, in the order they were written. A
+// consumer can subscribe before or after the command is started, even after it
+// has finished.
+//
+// The channel is closed after the last line is sent when the command finishes,
+// before its final Status is sent, or when cancel is called. cancel is
+// idempotent; call it when done receiving to release the subscription.
+//
+// Lines are only sent once complete, that is when their newline is written or
+// the command finishes; in the latter case, Line.Partial is true. A consumer
+// that subscribes while a line is partially written gets lines from the next
+// one, unless Replay is true. With Options.Split, where a token ends is not
+// known then, so the next token is dropped too. Lines longer than
+// DefaultMaxLineBufferSize are cut, followed by LineTruncationMarker.
+func (c *Cmd) Subscribe(opts SubscribeOptions) (<-chan Line, func()) {
+	return c.hub.subscribe(opts)
+}
+
+// outputHub fans out lines of output to subscribers. A Cmd always has one.
+type outputHub struct {
+	pub sync.Mutex // serializes publishing so subscribers get lines in the same order
+
+	*sync.Mutex               // guards the fields below
+	subs        []*subscriber // copied on change, so publishers can use it unlocked
+	keep        bool          // keep history for Replay
+	limits      OutputLimits  // bound the history like an OutputBuffer
+	historyHead []Line        // all lines, or the head lines if bounded
+	historyTail []Line        // lines after the head lines, if bounded
+	tailBytes   int           // length of tail lines, if bounded
+	seq         int           // Seq of the next line
+	closed      bool          // output ended
+}
+
+func newOutputHub() *outputHub {
+	return &outputHub{Mutex: &sync.Mutex{}}
+}
+
+// keepHistory makes the hub keep lines for SubscribeOptions.Replay within limits.
+func (h *outputHub) keepHistory(limits OutputLimits) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.keep = true
+	h.limits = limits
+}
+
+// writer returns a writer that splits output into lines, or tokens if split is
+// not nil, and publishes them as written to stream. Lines are bounded like
+// those of a bounded OutputBuffer.
+func (h *outputHub) writer(stream Stream, split bufio.SplitFunc) *hubWriter {
+	return &hubWriter{
+		hub:    h,
+		stream: stream,
+		split:  lineSplitter{fn: split, max: DefaultMaxLineBufferSize},
+	}
+}
+
+func (h *outputHub) subscribe(opts SubscribeOptions) (<-chan Line, func()) {
+	size := opts.Buffer
+	if size <= 0 {
+		size = DefaultStreamChanSize
+	}
+
+	s := &subscriber{
+		ch:     make(chan Line, size),
+		policy: opts.Policy,
+		done:   make(chan struct{}),
+		Mutex:  &sync.Mutex{},
+	}
+
+	cancel := func() {
+		s.once.Do(func() { close(s.done) })
+		h.remove(s)
+		s.close()
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	var history []Line
+	if opts.Replay {
+		history = h.historyLocked()
+	}
+
+	if !h.closed {
+		h.subs = append(h.subs[:len(h.subs):len(h.subs)], s)
+	}
+
+	if len(history) == 0 {
+		if h.closed {
+			s.close()
+		}
+
+		return s.ch, cancel
+	}
+
+	// Replay without blocking the caller, who has not begun receiving. Locking
+	// the subscriber first makes new lines wait until the history is sent.
+	closed := h.closed
+
+	s.Lock()
+
+	go func() {
+		defer s.Unlock()
+
+		for _, line := range history {
+			s.sendLocked(line)
+		}
+
+		if closed {
+			s.closeLocked()
+		}
+	}()
+
+	return s.ch, cancel
+}
+
+func (h *outputHub) remove(s *subscriber) {
+	h.Lock()
+	defer h.Unlock()
+
+	subs := make([]*subscriber, 0, len(h.subs))
+
+	for _, sub := range h.subs {
+		if sub != s {
+			subs = append(subs, sub)
+		}
+	}
+
+	h.subs = subs
+}
+
+// idle returns true if no one gets the lines.
+func (h *outputHub) idle() bool {
+	h.Lock()
+	defer h.Unlock()
+
+	return len(h.subs) == 0 && !h.keep
+}
+
+// publish sends line to all subscribers. The caller must hold the pub lock.
+func (h *outputHub) publish(line Line) {
+	h.Lock()
+	line.Timestamp = time.Now()
+	line.Seq = h.seq
+	h.seq++
+	h.remember(line)
+	subs := h.subs
+	h.Unlock()
+
+	for _, s := range subs {
+		s.send(line)
+	}
+}
+
+// lines returns the history. Lines are never modified once added, so the
+// caller can read them without holding the lock.
+func (h *outputHub) lines() []Line {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.historyLocked()
+}
+
+// historyLocked returns the head and tail lines of the history. The caller must
+// hold the lock.
+func (h *outputHub) historyLocked() []Line {
+	if len(h.historyTail) == 0 {
+		return h.historyHead[:len(h.historyHead):len(h.historyHead)]
+	}
+
+	history := make([]Line, 0, len(h.historyHead)+len(h.historyTail))
+	history = append(history, h.historyHead...)
+
+	return append(history, h.historyTail...)
+}
+
+// remember adds line to the history, keeping the first and last lines within
+// the limits like OutputBuffer. The caller must hold the lock.
+func (h *outputHub) remember(line Line) {
+	if !h.keep {
+		return
+	}
+
+	if !h.limits.bounded() || len(h.historyHead) < h.limits.HeadLines {
+		h.historyHead = append(h.historyHead, line)
+		return
+	}
+
+	h.historyTail = append(h.historyTail, line)
+	h.tailBytes += len(line.Text)
+
+	for len(h.historyTail) > 0 && h.limits.tailFull(len(h.historyTail), h.tailBytes) {
+		h.tailBytes -= len(h.historyTail[0].Text)
+		h.historyTail = h.historyTail[1:]
+	}
+}
+
+// close closes the channels of all subscribers after the last lines are sent.
+// Subscribers added later only get the history. It is idempotent.
+func (h *outputHub) close() {
+	h.pub.Lock()
+	defer h.pub.Unlock()
+
+	h.Lock()
+	h.closed = true
+	subs := h.subs
+	h.subs = nil
+	h.Unlock()
+
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+// hubWriter is the io.Writer of one stream of output published by a hub.
+type hubWriter struct {
+	hub    *outputHub
+	stream Stream
+	split  lineSplitter
+	skip   bool // drop output until the next line or token; it began when idle
+}
+
+// Write makes hubWriter implement the io.Writer interface.
+func (w *hubWriter) Write(p []byte) (n int, err error) {
+	w.hub.pub.Lock()
+	defer w.hub.pub.Unlock()
+
+	n = len(p)
+
+	// Do not split lines no one gets, but remember if the last one is partial
+	// so a new subscriber does not get only the end of it. Where tokens of a
+	// split function end is unknown, so then the next token is always dropped.
+	if w.hub.idle() {
+		w.split.reset()
+
+		if n > 0 {
+			w.skip = w.split.fn != nil || p[n-1] != '\n'
+		}
+
+		return n, nil
+	}
+
+	if w.skip && w.split.fn == nil {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			return n, nil
+		}
+
+		p = p[i+1:]
+		w.skip = false
+	}
+
+	// A split function error is returned by the other writers
+	_ = w.split.write(p, w.publish)
+
+	return n, nil
+}
+
+// flush publishes the pending last line, if any.
+func (w *hubWriter) flush() {
+	w.hub.pub.Lock()
+	defer w.hub.pub.Unlock()
+
+	if !w.skip {
+		w.split.flush(w.publishPartial)
+	}
+}
+
+func (w *hubWriter) publish(text string) {
+	if w.skip {
+		w.skip = false // the end of a token that began when idle
+		return
+	}
+
+	w.hub.publish(Line{Text: text, Stream: w.stream})
+}
+
+func (w *hubWriter) publishPartial(text string) {
+	w.hub.publish(Line{Text: text, Stream: w.stream, Partial: true})
+}
+
+// subscriber is one channel of Cmd.Subscribe.
+type subscriber struct {
+	ch     chan Line
+	policy StreamPolicy
+	done   chan struct{} // closed by cancel
+	once   sync.Once
+
+	*sync.Mutex // held while sending; guards closed
+	closed      bool
+}
+
+func (s *subscriber) send(line Line) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sendLocked(line)
+}
+
+// sendLocked sends line according to the policy. The caller must hold the lock.
+func (s *subscriber) sendLocked(line Line) {
+	if s.closed {
+		return
+	}
+
+	switch s.policy {
+	case StreamDropNewest:
+		select {
+		case s.ch <- line:
+		default:
+		}
+	case StreamDropOldest:
+		for {
+			select {
+			case s.ch <- line:
+				return
+			default:
+			}
+
+			select {
+			case <-s.ch:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- line:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.closeLocked()
+}
+
+// closeLocked closes the channel. The caller must hold the lock.
+func (s *subscriber) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
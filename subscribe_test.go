@@ -0,0 +1,253 @@
+package cmd_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gobars/cmd"
+)
+
+func receiveAll(lines <-chan cmd.Line) []cmd.Line {
+	var got []cmd.Line
+	for line := range lines {
+		got = append(got, line)
+	}
+
+	return got
+}
+
+// withoutTime zeroes the nondeterministic Timestamp and Seq of lines.
+func withoutTime(lines []cmd.Line) []cmd.Line {
+	for i := range lines {
+		lines[i].Timestamp = time.Time{}
+		lines[i].Seq = 0
+	}
+
+	return lines
+}
+
+func TestSubscribe(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{}, "bash", "-c", "echo 1; sleep 0.1; echo 2 >&2; sleep 0.1; echo 3; printf 4")
+
+	// Each subscriber gets all lines in the order they were written
+	var (
+		wg  sync.WaitGroup
+		got [2][]cmd.Line
+	)
+
+	for i := range got {
+		lines, cancel := p.Subscribe(cmd.SubscribeOptions{})
+		defer cancel()
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			got[i] = receiveAll(lines)
+		}(i)
+	}
+
+	s := <-p.Start()
+	if s.Exit != 0 {
+		t.Errorf("got exit %d, expected 0", s.Exit)
+	}
+
+	wg.Wait()
+
+	expect := []cmd.Line{
+		{Text: "1", Stream: cmd.StreamStdout},
+		{Text: "2", Stream: cmd.StreamStderr},
+		{Text: "3", Stream: cmd.StreamStdout},
+		{Text: "4", Stream: cmd.StreamStdout, Partial: true}, // printf, no newline
+	}
+
+	for i := range got {
+		if diffs := deep.Equal(withoutTime(got[i]), expect); diffs != nil {
+			t.Error(i, diffs)
+		}
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Replay: true}, "seq", "3")
+	<-p.Start()
+
+	// Subscribing after the command finished replays the buffered output
+	lines, cancel := p.Subscribe(cmd.SubscribeOptions{Replay: true, Buffer: 1})
+	defer cancel()
+
+	expect := []cmd.Line{
+		{Text: "1", Stream: cmd.StreamStdout},
+		{Text: "2", Stream: cmd.StreamStdout},
+		{Text: "3", Stream: cmd.StreamStdout},
+	}
+	if diffs := deep.Equal(withoutTime(receiveAll(lines)), expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	// Without Replay, the channel is closed right away
+	lines, cancel = p.Subscribe(cmd.SubscribeOptions{})
+	defer cancel()
+
+	if got := receiveAll(lines); len(got) != 0 {
+		t.Errorf("got %v, expected no lines", got)
+	}
+
+	// Without Options.Replay, no lines are kept to replay
+	p = cmd.NewCmd("seq", "3")
+	<-p.Start()
+
+	lines, cancel = p.Subscribe(cmd.SubscribeOptions{Replay: true})
+	defer cancel()
+
+	if got := receiveAll(lines); len(got) != 0 {
+		t.Errorf("got %v, expected no lines", got)
+	}
+}
+
+func TestSubscribeReplayBounded(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{
+		Replay:       true,
+		OutputLimits: cmd.OutputLimits{HeadLines: 1, TailLines: 2},
+	}, "seq", "5")
+	<-p.Start()
+
+	lines, cancel := p.Subscribe(cmd.SubscribeOptions{Replay: true})
+	defer cancel()
+
+	// The first and last lines are kept, like in the buffers
+	expect := []cmd.Line{
+		{Text: "1", Stream: cmd.StreamStdout},
+		{Text: "4", Stream: cmd.StreamStdout},
+		{Text: "5", Stream: cmd.StreamStdout},
+	}
+	if diffs := deep.Equal(withoutTime(receiveAll(lines)), expect); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestSubscribePolicy(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{}, "seq", "5")
+
+	newest, cancelNewest := p.Subscribe(cmd.SubscribeOptions{Buffer: 2, Policy: cmd.StreamDropNewest})
+	defer cancelNewest()
+
+	oldest, cancelOldest := p.Subscribe(cmd.SubscribeOptions{Buffer: 2, Policy: cmd.StreamDropOldest})
+	defer cancelOldest()
+
+	// Neither subscriber is read while the command runs, yet it's not blocked
+	s := <-p.Start()
+	if s.Exit != 0 {
+		t.Errorf("got exit %d, expected 0", s.Exit)
+	}
+
+	expect := []cmd.Line{
+		{Text: "1", Stream: cmd.StreamStdout},
+		{Text: "2", Stream: cmd.StreamStdout},
+	}
+	if diffs := deep.Equal(withoutTime(receiveAll(newest)), expect); diffs != nil {
+		t.Error(diffs)
+	}
+
+	expect = []cmd.Line{
+		{Text: "4", Stream: cmd.StreamStdout},
+		{Text: "5", Stream: cmd.StreamStdout},
+	}
+	if diffs := deep.Equal(withoutTime(receiveAll(oldest)), expect); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{}, "./test/count-and-sleep", "3", "5")
+
+	// A blocking subscriber that is never read
+	_, cancelBlocked := p.Subscribe(cmd.SubscribeOptions{Buffer: 1})
+
+	lines, cancel := p.Subscribe(cmd.SubscribeOptions{})
+
+	p.Start()
+
+	if line := <-lines; line.Text != "1" {
+		t.Errorf("got line %q, expected \"1\"", line.Text)
+	}
+
+	cancel()
+	cancel() // idempotent
+
+	// Canceling the subscription closes the channel
+	for range lines {
+	}
+
+	cancelBlocked()
+
+	if err := p.Stop(); err != nil {
+		t.Error(err)
+	}
+
+	<-p.Done()
+}
+
+func TestStreamLines(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{Buffered: true, StreamLines: true},
+		"bash", "-c", "echo 1; sleep 0.1; echo 2 >&2; sleep 0.1; echo 3")
+
+	before := time.Now()
+	statusChan := p.Start()
+	got := receiveAll(p.Lines) // closed before the final status is sent
+	s := <-statusChan
+
+	expect := []struct {
+		text   string
+		stream cmd.Stream
+	}{
+		{"1", cmd.StreamStdout},
+		{"2", cmd.StreamStderr},
+		{"3", cmd.StreamStdout},
+	}
+
+	if len(got) != len(expect) {
+		t.Fatalf("got %v, expected %d lines", got, len(expect))
+	}
+
+	for i, line := range got {
+		if line.Text != expect[i].text || line.Stream != expect[i].stream || line.Seq != i {
+			t.Errorf("got line %d %+v, expected %+v", i, line, expect[i])
+		}
+
+		if line.Timestamp.Before(before) {
+			t.Errorf("line %d timestamp %s before start %s", i, line.Timestamp, before)
+		}
+
+		before = line.Timestamp
+	}
+
+	// The same records are buffered in the status
+	if diffs := deep.Equal(s.Lines, got); diffs != nil {
+		t.Error(diffs)
+	}
+}
+
+func TestStreamLinesOptionsTwice(t *testing.T) {
+	p := cmd.NewCmdOptions(cmd.Options{StreamLines: true}, "seq", "3")
+	first := p.Lines
+
+	// Applying options again replaces the subscription of Lines, so the first
+	// one, which no one reads, does not stall the command
+	p.Options(func(o *cmd.Options) { o.StreamLines = true })
+
+	if _, ok := <-first; ok {
+		t.Error("got line on the first Lines channel, expected it closed")
+	}
+
+	statusChan := p.Start()
+	got := receiveAll(p.Lines)
+	<-statusChan
+
+	if len(got) != 3 {
+		t.Errorf("got %v, expected 3 lines", got)
+	}
+}
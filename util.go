@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"io"
 	"time"
 )
 
 // Run runs a cmd.
-func Run(cmdparts ...string) (*Cmd, Status) { p := NewCmd(cmdparts...); return p, <-p.Start() }
+func Run(cmdparts ...string) (*Cmd, Status) { return RunContext(context.Background(), cmdparts...) }
+
+// RunContext runs a cmd which is stopped when ctx is done.
+func RunContext(ctx context.Context, cmdparts ...string) (*Cmd, Status) {
+	p := NewCmd(cmdparts...)
+	return p, <-p.StartContext(ctx)
+}
 
 // BashLiner execute a bash script with line output processing.
 func BashLiner(bash string, liner func(line string) bool, optionFns ...OptionFn) (*Cmd, Status) {
@@ -30,10 +38,15 @@ func BashLiner(bash string, liner func(line string) bool, optionFns ...OptionFn)
 
 // Bash executes a bash scripts.
 func Bash(bash string, optionFns ...OptionFn) (*Cmd, Status) {
+	return BashContext(context.Background(), bash, optionFns...)
+}
+
+// BashContext executes a bash scripts which is stopped when ctx is done.
+func BashContext(ctx context.Context, bash string, optionFns ...OptionFn) (*Cmd, Status) {
 	p := NewCmd("bash", "-c", bash)
 	p.Options(optionFns...)
 
-	return p, <-p.Start()
+	return p, <-p.StartContext(ctx)
 }
 
 func createOption(optionFns []OptionFn) Options {
@@ -75,6 +88,9 @@ func Streaming() OptionFn { return func(opt *Options) { opt.Streaming = true } }
 // Stdin set cmd stdin enabled or not.
 func Stdin() OptionFn { return func(opt *Options) { opt.StdinEnabled = true } }
 
+// StdinReader set a reader to be copied to cmd stdin.
+func StdinReader(r io.Reader) OptionFn { return func(opt *Options) { opt.StdinReader = r } }
+
 // Options apply some options to cmd.
 func (c *Cmd) Options(fns ...OptionFn) { c.applyOption(createOption(fns)) }
 
@@ -1,7 +1,10 @@
 package cmd_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +17,17 @@ func TestBash(t *testing.T) {
 	assert.Equal(t, []string{"Hello"}, status.Stdout)
 }
 
+func TestBashContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, status := cmd.BashContext(ctx, `echo hello; sleep 5; echo world`)
+	assert.Equal(t, []string{"hello"}, status.Stdout)
+	assert.True(t, status.Cancelled)
+	assert.Equal(t, cmd.ReasonContextCancelled, status.Reason)
+	assert.False(t, status.Complete)
+}
+
 func TestBashEnv(t *testing.T) {
 	_, status := cmd.Bash(`echo $MYSQLPWD`, cmd.Env("MYSQLPWD=!abc"))
 	assert.Equal(t, []string{"!abc"}, status.Stdout)
@@ -31,6 +45,7 @@ func TestBashLinerFalse(t *testing.T) {
 		return false
 	}, cmd.Timeout(3*time.Second))
 	assert.NotNil(t, status.Error)
+	assert.Equal(t, cmd.ReasonStopped, status.Reason)
 }
 
 func TestBashLinerTrue(t *testing.T) {
@@ -39,6 +54,8 @@ func TestBashLinerTrue(t *testing.T) {
 		return true
 	}, cmd.Timeout(1*time.Second))
 	assert.NotNil(t, status.Error)
+	assert.Equal(t, cmd.ReasonTimedOut, status.Reason)
+	assert.True(t, errors.Is(status.Error, cmd.ErrTimeout))
 }
 
 func TestStdinEnabled(t *testing.T) {
@@ -59,6 +76,76 @@ func TestStdinEnabled(t *testing.T) {
 	assert.Equal(t, []string{"Input string", "Line 2"}, status.Stdout)
 }
 
+func TestStdinReader(t *testing.T) {
+	_, status := cmd.Bash("sort", cmd.StdinReader(strings.NewReader("b\nc\na\n")))
+	assert.Equal(t, []string{"a", "b", "c"}, status.Stdout)
+	assert.True(t, status.Complete)
+}
+
+func TestStdinWriter(t *testing.T) {
+	p := cmd.NewCmd("od", "-An", "-tx1")
+	p.Options(cmd.Stdin())
+	w := p.StdinWriter()
+
+	_, err := w.Write([]byte{0x00})
+	assert.Equal(t, cmd.ErrNotStarted, err)
+
+	statusChan := p.Start()
+
+	// Binary data and partial lines are written as is, no newline appended
+	_, err = w.Write([]byte{0x00, 0xff})
+	assert.Nil(t, err)
+	_, err = w.Write([]byte("a"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	status := <-statusChan
+	assert.Equal(t, []string{" 00 ff 61"}, status.Stdout)
+	assert.True(t, status.Complete)
+
+	_, err = w.Write([]byte("a"))
+	assert.Equal(t, cmd.ErrStdinClosed, err)
+}
+
+func TestStdinWriterError(t *testing.T) {
+	p := cmd.NewCmd("true")
+	p.Options(cmd.Stdin())
+	<-p.Start()
+
+	// The command has exited, so the write fails instead of being swallowed
+	_, err := p.StdinWriter().Write([]byte("a"))
+	assert.NotNil(t, err)
+
+	assert.Nil(t, cmd.NewCmd("true").StdinWriter())
+}
+
+func TestCloseStdin(t *testing.T) {
+	p := cmd.NewCmd("sort")
+	p.Options(cmd.Stdin())
+	statusChan := p.Start()
+
+	p.Stdin <- "b"
+	p.Stdin <- "a"
+	assert.Nil(t, p.CloseStdin())
+	assert.Nil(t, p.CloseStdin()) // idempotent
+
+	status := <-statusChan
+	assert.Equal(t, []string{"a", "b"}, status.Stdout)
+	assert.True(t, status.Complete)
+	assert.Equal(t, cmd.ReasonExited, status.Reason)
+	assert.Nil(t, status.Error)
+}
+
+func TestCloseStdinBeforeStart(t *testing.T) {
+	p := cmd.NewCmd("wc", "-l")
+	p.Options(cmd.Stdin())
+	assert.Nil(t, p.CloseStdin())
+
+	status := <-p.Start()
+	assert.Equal(t, []string{"0"}, status.Stdout)
+	assert.True(t, status.Complete)
+}
+
 func TestStdinEnabledStream(t *testing.T) {
 	p := cmd.NewCmd("bash", "-c", "cat")
 	p.Options(cmd.Stdin(), cmd.Streaming(), cmd.Buffered(false))